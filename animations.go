@@ -1,15 +1,32 @@
 package main
 
 import (
+	"maps"
+	"math"
+	"slices"
+
 	"github.com/gopxl/pixel"
 )
 
+// Animator plays named animations made up of frames of sprites.
+// Animations loop by default, but can be set to play once, and can fire named events when they reach a frame.
 type Animator struct {
 	sprites          map[string]*pixel.Sprite
 	animations       map[string][]string
 	animationsTimes  map[string]float64
+	oneShots         map[string]bool
+	events           map[string]map[int][]string
+	codeOneShots     map[string]bool  // Set with SetLooping, so they are kept when the atlas is reloaded
+	codeEvents       []animationEvent // Added with AddEvent, so they are kept when the atlas is reloaded
 	currentTime      float64
 	currentAnimation string
+	speed            float64
+	finished         bool
+	playingOnce      bool
+	onFinish         func(anim string)
+	onEvent          func(anim, event string)
+	atlasName        string
+	resVersion       int
 }
 
 func NewAnimator(pic pixel.Picture, spriteWidth float64, spritesPosses map[string]pixel.Vec, animations map[string][]string, animationsTimes map[string]float64) *Animator {
@@ -22,29 +39,239 @@ func NewAnimator(pic pixel.Picture, spriteWidth float64, spritesPosses map[strin
 		animations:      animations,
 		currentTime:     0,
 		animationsTimes: animationsTimes,
+		oneShots:        make(map[string]bool),
+		events:          make(map[string]map[int][]string),
+		codeOneShots:    make(map[string]bool),
+		speed:           1,
+	}
+}
+
+// animationEvent is an event fired when an animation reaches a frame
+type animationEvent struct {
+	anim  string
+	frame int
+	event string
+}
+
+// NewAtlasAnimator creates an animator using the sprite and atlas with the given name.
+// If either resource is reloaded, the animator will pick up the changes.
+func NewAtlasAnimator(name string) *Animator {
+	a := &Animator{atlasName: name, speed: 1, codeOneShots: make(map[string]bool)}
+	a.loadAtlas()
+	return a
+}
+
+// loadAtlas rebuilds the sprites, animations and events from the animator's atlas.
+// Anything set up in code is applied again on top, so it survives the atlas being reloaded.
+func (a *Animator) loadAtlas() {
+	atlas := GetSpriteAtlas(a.atlasName)
+	spritesPosses := make(map[string]pixel.Vec)
+	for name, pos := range atlas.Sprites {
+		spritesPosses[name] = pixel.V(pos[0], pos[1])
+	}
+	na := NewAnimator(GetSpritePicture(a.atlasName), atlas.SpriteWidth, spritesPosses, atlas.Animations, atlas.AnimationTimes)
+	a.sprites, a.animations, a.animationsTimes = na.sprites, na.animations, na.animationsTimes
+	a.oneShots, a.events = na.oneShots, na.events
+	for _, anim := range atlas.OneShots {
+		a.oneShots[anim] = true
+	}
+	for anim, frames := range atlas.Events {
+		for frame, events := range frames {
+			for _, event := range events {
+				a.addEvent(animationEvent{anim, frame, event})
+			}
+		}
+	}
+	for anim, oneShot := range a.codeOneShots {
+		a.oneShots[anim] = oneShot
+	}
+	for _, ev := range a.codeEvents {
+		a.addEvent(ev)
+	}
+	a.resVersion = globalResVersion
+}
+
+// refresh reloads the atlas if the global resources have changed since it was last loaded
+func (a *Animator) refresh() {
+	if a.atlasName != "" && a.resVersion != globalResVersion {
+		a.loadAtlas()
+	}
+}
+
+// Clone copies the animator and its playback state. The sprites and animations are shared with the original, but
+// looping and events are copied, so setting them on the clone does not change the original.
+func (a *Animator) Clone() *Animator {
+	clone := *a
+	clone.oneShots = maps.Clone(a.oneShots)
+	clone.codeOneShots = maps.Clone(a.codeOneShots)
+	clone.events = make(map[string]map[int][]string, len(a.events))
+	for anim, frames := range a.events {
+		clone.events[anim] = make(map[int][]string, len(frames))
+		for frame, events := range frames {
+			clone.events[anim][frame] = slices.Clone(events)
+		}
+	}
+	clone.codeEvents = slices.Clone(a.codeEvents)
+	return &clone
+}
+
+// SetLooping sets whether an animation loops, or stops on its last frame
+func (a *Animator) SetLooping(anim string, looping bool) {
+	a.oneShots[anim] = !looping
+	a.codeOneShots[anim] = !looping
+}
+
+// AddEvent adds an event that will fire whenever the animation reaches the frame (starting at 0)
+func (a *Animator) AddEvent(anim string, frame int, event string) {
+	ev := animationEvent{anim, frame, event}
+	a.addEvent(ev)
+	a.codeEvents = append(a.codeEvents, ev)
+}
+
+func (a *Animator) addEvent(ev animationEvent) {
+	if _, ok := a.events[ev.anim]; !ok {
+		a.events[ev.anim] = make(map[int][]string)
+	}
+	a.events[ev.anim][ev.frame] = append(a.events[ev.anim][ev.frame], ev.event)
+}
+
+// OnEvent sets the function called when an animation event fires
+func (a *Animator) OnEvent(f func(anim, event string)) {
+	a.onEvent = f
+}
+
+// SetSpeed sets the playback speed multiplier, where 1 is normal speed
+func (a *Animator) SetSpeed(speed float64) {
+	a.speed = math.Max(0, speed)
+}
+
+// Has returns whether the animator knows about an animation
+func (a *Animator) Has(anim string) bool {
+	a.refresh()
+	return len(a.animations[anim]) > 0 && a.animationsTimes[anim] > 0
+}
+
+// Current returns the name of the currently playing animation
+func (a *Animator) Current() string {
+	return a.currentAnimation
+}
+
+// Finished returns whether a one-shot animation has reached its end
+func (a *Animator) Finished() bool {
+	return a.finished
+}
+
+// NormalisedTime returns how far through the current loop of the animation we are, between 0 and 1
+func (a *Animator) NormalisedTime() float64 {
+	if a.finished {
+		return 1
 	}
+	return a.currentTime - math.Floor(a.currentTime)
 }
 
 func (a *Animator) Step(dt float64) {
-	a.currentTime += dt / a.animationsTimes[a.currentAnimation]
+	a.refresh()
+	if a.finished || !a.Has(a.currentAnimation) {
+		return
+	}
+	anim := a.currentAnimation
+	numFrames := len(a.animations[anim])
+	lastFrame := a.absoluteFrame()
+	a.currentTime += dt * a.speed / a.animationsTimes[anim]
+	if (a.oneShots[anim] || a.playingOnce) && a.currentTime >= 1 {
+		a.currentTime = 1
+		a.finished = true
+	}
+	// Fire the events of every frame we passed over, including the end frame of a one shot
+	nextFrame := a.absoluteFrame()
+	if a.finished {
+		nextFrame = numFrames - 1
+	}
+	for f := lastFrame + 1; f <= nextFrame; f++ {
+		a.fireEvents(anim, f%numFrames)
+		if a.currentAnimation != anim {
+			// An event changed the animation
+			return
+		}
+	}
+	if a.finished && a.onFinish != nil {
+		onFinish := a.onFinish
+		a.onFinish = nil
+		onFinish(anim)
+	}
+}
+
+// absoluteFrame is the number of frames played since the animation started
+func (a *Animator) absoluteFrame() int {
+	return int(a.currentTime * float64(len(a.animations[a.currentAnimation])))
 }
 
+func (a *Animator) fireEvents(anim string, frame int) {
+	if a.onEvent == nil {
+		return
+	}
+	for _, event := range a.events[anim][frame] {
+		a.onEvent(anim, event)
+	}
+}
+
+// CurrentSprite returns the sprite to draw, or nil if no valid animation is playing
 func (a *Animator) CurrentSprite() *pixel.Sprite {
+	a.refresh()
+	if !a.Has(a.currentAnimation) {
+		return nil
+	}
 	ca := a.animations[a.currentAnimation]
-	iF := a.currentTime * float64(len(ca))
-	i := int(iF) % len(ca)
+	i := a.absoluteFrame() % len(ca)
+	if a.finished {
+		i = len(ca) - 1
+	}
 	return a.sprites[ca[i]]
 }
 
+// Play starts an animation from the beginning. Unknown animations are ignored.
 func (a *Animator) Play(anim string) {
+	if !a.Has(anim) {
+		return
+	}
 	a.currentAnimation = anim
 	a.currentTime = 0
+	a.finished = false
+	a.playingOnce = false
+	a.onFinish = nil
+	a.fireEvents(anim, 0)
+}
+
+// PlayOnce plays an animation from the beginning without looping, calling onFinish (if not nil) when it ends
+func (a *Animator) PlayOnce(anim string, onFinish func(anim string)) {
+	if !a.Has(anim) {
+		return
+	}
+	a.Play(anim)
+	a.playingOnce = true
+	a.onFinish = onFinish
 }
 
 func (a *Animator) PlayIfNot(anim string) {
 	if a.currentAnimation == anim {
 		return
 	}
+	a.Play(anim)
+}
+
+// SwitchTo changes to another animation if it is not already playing.
+// If the two animations have the same number of frames, the normalised time is carried over so the switch is seamless.
+func (a *Animator) SwitchTo(anim string) {
+	if a.currentAnimation == anim || !a.Has(anim) {
+		return
+	}
+	if a.finished || !a.Has(a.currentAnimation) || len(a.animations[anim]) != len(a.animations[a.currentAnimation]) {
+		a.Play(anim)
+		return
+	}
+	t := a.NormalisedTime()
 	a.currentAnimation = anim
-	a.currentTime = 0
+	a.currentTime = t
+	a.playingOnce = false
+	a.onFinish = nil
 }
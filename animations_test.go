@@ -0,0 +1,195 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gopxl/pixel"
+)
+
+// newTestAnimator makes an animator over a blank picture with a four frame "swim" animation and a two frame "turn"
+// animation, both lasting one second, so it can be tested without a window
+func newTestAnimator() *Animator {
+	pic := pixel.MakePictureData(pixel.R(0, 0, 4, 2))
+	sprites := map[string]pixel.Vec{
+		"swim.0": pixel.V(0, 0), "swim.1": pixel.V(1, 0), "swim.2": pixel.V(2, 0), "swim.3": pixel.V(3, 0),
+		"turn.0": pixel.V(0, 1), "turn.1": pixel.V(1, 1),
+	}
+	animations := map[string][]string{
+		"swim": {"swim.0", "swim.1", "swim.2", "swim.3"},
+		"turn": {"turn.0", "turn.1"},
+	}
+	times := map[string]float64{"swim": 1, "turn": 1}
+	return NewAnimator(pic, 1, sprites, animations, times)
+}
+
+// stepFor steps an animator forward in 10ms steps
+func stepFor(a *Animator, seconds float64) {
+	for t := 0.0; t < seconds-1e-9; t += 0.01 {
+		a.Step(0.01)
+	}
+}
+
+func TestAnimatorLooping(t *testing.T) {
+	a := newTestAnimator()
+	a.Play("swim")
+	stepFor(a, 1.3)
+	if a.Finished() {
+		t.Fatal("looping animation finished")
+	}
+	if got, want := a.CurrentSprite(), a.sprites["swim.1"]; got != want {
+		t.Errorf("after 1.3s got frame %v, want swim.1", got.Frame())
+	}
+}
+
+func TestAnimatorOneShot(t *testing.T) {
+	a := newTestAnimator()
+	a.SetLooping("swim", false)
+	a.Play("swim")
+	stepFor(a, 1.5)
+	if !a.Finished() {
+		t.Fatal("one-shot animation did not finish")
+	}
+	if a.CurrentSprite() != a.sprites["swim.3"] {
+		t.Error("finished one-shot is not held on its last frame")
+	}
+	if a.NormalisedTime() != 1 {
+		t.Errorf("finished one-shot has normalised time %v, want 1", a.NormalisedTime())
+	}
+
+	finished := 0
+	a.PlayOnce("turn", func(anim string) {
+		if anim != "turn" {
+			t.Errorf("finished %q, want turn", anim)
+		}
+		finished++
+	})
+	stepFor(a, 3)
+	if finished != 1 {
+		t.Errorf("PlayOnce called onFinish %d times, want 1", finished)
+	}
+}
+
+func TestAnimatorEvents(t *testing.T) {
+	a := newTestAnimator()
+	a.AddEvent("swim", 0, "start")
+	a.AddEvent("swim", 2, "kick")
+	var fired []string
+	a.OnEvent(func(anim, event string) { fired = append(fired, event) })
+	a.Play("swim")
+	stepFor(a, 2.1)
+	if want := []string{"start", "kick", "start", "kick", "start"}; !slices.Equal(fired, want) {
+		t.Errorf("fired %v, want %v", fired, want)
+	}
+
+	// A step long enough to skip over frames still fires the events on them
+	fired = nil
+	a.Play("swim")
+	a.Step(0.9)
+	if want := []string{"start", "kick"}; !slices.Equal(fired, want) {
+		t.Errorf("fired %v over a long step, want %v", fired, want)
+	}
+}
+
+func TestAnimatorSwitchKeepsTime(t *testing.T) {
+	a := newTestAnimator()
+	a.sprites["turn.2"], a.sprites["turn.3"] = a.sprites["turn.0"], a.sprites["turn.1"]
+	a.animations["turn"] = []string{"turn.0", "turn.1", "turn.2", "turn.3"}
+	a.Play("swim")
+	stepFor(a, 0.6)
+	a.SwitchTo("turn")
+	if got := a.NormalisedTime(); got < 0.59 || got > 0.61 {
+		t.Errorf("switching between animations of the same length reset the time to %v", got)
+	}
+}
+
+// writeTestAtlas writes a sprite sheet and atlas called testanim to dir, then loads them as resources
+func writeTestAtlas(t *testing.T, dir, atlas string) {
+	t.Helper()
+	picPath := filepath.Join(dir, "testanim.png")
+	f, err := os.Create(picPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 4, 1))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	atlasPath := filepath.Join(dir, "testanim.json")
+	if err := os.WriteFile(atlasPath, []byte(atlas), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{picPath, atlasPath} {
+		if err := ReloadResource(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAnimatorReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTestAtlas(t, dir, `{
+		"sprite-width": 1,
+		"sprites": {"a": [0, 0], "b": [1, 0], "c": [2, 0], "d": [3, 0]},
+		"animations": {"swim": ["a", "b"], "dash": ["c", "d"]},
+		"animation-times": {"swim": 1, "dash": 1},
+		"events": {"swim": {"1": ["atlas"]}}
+	}`)
+	a := NewAtlasAnimator("testanim")
+	a.SetLooping("dash", false)
+	a.AddEvent("swim", 0, "code")
+	var fired []string
+	a.OnEvent(func(anim, event string) { fired = append(fired, event) })
+
+	// Change the timing and events in the atlas
+	writeTestAtlas(t, dir, `{
+		"sprite-width": 1,
+		"sprites": {"a": [0, 0], "b": [1, 0], "c": [2, 0], "d": [3, 0]},
+		"animations": {"swim": ["a", "b", "c"], "dash": ["c", "d"]},
+		"animation-times": {"swim": 3, "dash": 1},
+		"events": {"swim": {"2": ["reloaded"]}}
+	}`)
+	a.Play("swim")
+	stepFor(a, 2.5)
+	if want := []string{"code", "reloaded"}; !slices.Equal(fired, want) {
+		t.Errorf("after reload fired %v, want %v", fired, want)
+	}
+	a.Play("dash")
+	stepFor(a, 2)
+	if !a.Finished() {
+		t.Error("one-shot set in code was lost when the atlas reloaded")
+	}
+
+	// Removing the playing animation leaves nothing to draw, rather than panicking
+	writeTestAtlas(t, dir, `{
+		"sprite-width": 1,
+		"sprites": {"a": [0, 0]},
+		"animations": {"swim": ["a"]},
+		"animation-times": {"swim": 1}
+	}`)
+	a.Step(0.1)
+	if s := a.CurrentSprite(); s != nil {
+		t.Error("removed animation still has a sprite")
+	}
+}
+
+func TestAnimatorCloneIsSeparate(t *testing.T) {
+	a := newTestAnimator()
+	a.AddEvent("swim", 1, "original")
+	clone := a.Clone()
+	clone.SetLooping("swim", false)
+	clone.AddEvent("swim", 1, "clone")
+	if a.oneShots["swim"] || a.codeOneShots["swim"] {
+		t.Error("setting looping on the clone changed the original")
+	}
+	if got := a.events["swim"][1]; len(got) != 1 || len(a.codeEvents) != 1 {
+		t.Errorf("adding an event to the clone changed the original's events to %v", got)
+	}
+	if got := clone.events["swim"][1]; len(got) != 2 {
+		t.Errorf("clone has events %v, want both", got)
+	}
+}
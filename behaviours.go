@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gopxl/pixel"
+)
+
+// Behaviour is one part of what a creature does. Behaviours are created from an entity definition,
+// and their exported fields are the parameters read from it. Each behaviour is either a Steering or an Actuator.
+type Behaviour interface {
+	Name() string
+	Clone() Behaviour // Clone returns a copy with its own state, used when cloning the creature
+}
+
+// Steering behaviours suggest which way a creature should swim. The suggestion should be no longer than 1,
+// with its length showing how strongly the behaviour wants to go that way, and zero meaning it has no opinion.
+// A creature combines the suggestions of all of its steering behaviours using its arbitration policy.
+type Steering interface {
+	Behaviour
+	Steer(c *CreatureEntity, w *World) pixel.Vec
+}
+
+// Actuators act on the creature directly, such as pushing or animating it, after steering has been decided
+type Actuator interface {
+	Behaviour
+	Act(c *CreatureEntity, w *World)
+}
+
+// behaviourTypes creates a behaviour of each type with default parameters, ready for the definition to overwrite
+var behaviourTypes = map[string]func() Behaviour{
+	"wander": func() Behaviour { return &WanderBehaviour{Interval: 5} },
+	"seek":   func() Behaviour { return &SeekBehaviour{Tag: "fish", Radius: 8} },
+	"flee":   func() Behaviour { return &FleeBehaviour{Tag: "predator", Radius: 6} },
+	"flee-sound": func() Behaviour {
+		return &FleeSoundBehaviour{Kinds: []string{StimulusAlarm, StimulusSplash}}
+	},
+	"flock": func() Behaviour {
+		return &FlockBehaviour{Tag: "fish", Radius: 3, Separation: 1, Alignment: 1, Cohesion: 1}
+	},
+	"avoid-terrain": func() Behaviour { return &AvoidTerrainBehaviour{Distance: 3, Rays: 5, Spread: 90} },
+	"follow-scent":  func() Behaviour { return &FollowScentBehaviour{Channel: ScentFood, Above: 0.01} },
+	"seek-comfort":  func() Behaviour { return &SeekComfortBehaviour{Distance: 5, Rays: 8} },
+	"deposit":       func() Behaviour { return &DepositBehaviour{Channel: ScentPheromone, Rate: 1} },
+	"thrust":        func() Behaviour { return &ThrustBehaviour{Force: 5} },
+	"drag":          func() Behaviour { return &DragBehaviour{Coeff: 1} },
+	"animate":       func() Behaviour { return &AnimateBehaviour{Left: "swimleft", Right: "swimright", Speed: 0.5} },
+}
+
+// weightedBehaviour is a behaviour along with how much its steering counts when combined with the others
+type weightedBehaviour struct {
+	Behaviour
+	weight float64
+}
+
+// steeringThreshold is the length below which a steering suggestion is treated as having no opinion
+const steeringThreshold = 1e-3
+
+// ArbitrationPolicy combines the suggestions of steering behaviours, given in the order they are listed, into one
+type ArbitrationPolicy func(suggestions []pixel.Vec, weights []float64) pixel.Vec
+
+// arbitrationPolicies are the ways a definition can choose to combine its steering behaviours
+var arbitrationPolicies = map[string]ArbitrationPolicy{
+	"weighted-sum": WeightedSumArbitration,
+	"priority":     PriorityArbitration,
+	"truncation":   TruncationArbitration,
+}
+
+// GetArbitrationPolicy finds an arbitration policy by name. An empty name is a weighted sum.
+func GetArbitrationPolicy(name string) (ArbitrationPolicy, error) {
+	if name == "" {
+		return WeightedSumArbitration, nil
+	}
+	policy, ok := arbitrationPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown arbitration policy %q", name)
+	}
+	return policy, nil
+}
+
+// WeightedSumArbitration adds up every suggestion multiplied by its weight
+func WeightedSumArbitration(suggestions []pixel.Vec, weights []float64) pixel.Vec {
+	total := pixel.ZV
+	for i, s := range suggestions {
+		total = total.Add(s.Scaled(weights[i]))
+	}
+	return total
+}
+
+// PriorityArbitration uses only the first suggestion that has an opinion, ignoring the weights
+func PriorityArbitration(suggestions []pixel.Vec, weights []float64) pixel.Vec {
+	for _, s := range suggestions {
+		if s.Len() > steeringThreshold {
+			return s
+		}
+	}
+	return pixel.ZV
+}
+
+// TruncationArbitration adds up weighted suggestions in order until their total length reaches 1,
+// cutting the last one short, so earlier behaviours are satisfied before later ones get a say
+func TruncationArbitration(suggestions []pixel.Vec, weights []float64) pixel.Vec {
+	total := pixel.ZV
+	used := 0.0
+	for i, s := range suggestions {
+		s = s.Scaled(weights[i])
+		l := s.Len()
+		if used+l >= 1 {
+			return total.Add(s.Scaled((1 - used) / l))
+		}
+		total = total.Add(s)
+		used += l
+	}
+	return total
+}
+
+// clampLen shortens v to be no longer than max
+func clampLen(v pixel.Vec, max float64) pixel.Vec {
+	if l := v.Len(); l > max {
+		return v.Scaled(max / l)
+	}
+	return v
+}
+
+// ThrustBehaviour pushes the creature forwards in the direction it is facing, scaled by the speed chosen by its brain.
+// Creatures can only swim while they are in the water.
+type ThrustBehaviour struct {
+	Force float64 `json:"force"`
+}
+
+func (b *ThrustBehaviour) Name() string { return "thrust" }
+
+func (b *ThrustBehaviour) Act(c *CreatureEntity, w *World) {
+	if w.InWater(c.Position()) {
+		c.ApplyForce(c.Heading().Scaled(b.Force * c.speed))
+	}
+}
+
+func (b *ThrustBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// DragBehaviour slows the creature down as it moves through the water, and carries it along with the water's flow
+type DragBehaviour struct {
+	Coeff float64 `json:"coeff"`
+}
+
+func (b *DragBehaviour) Name() string { return "drag" }
+
+func (b *DragBehaviour) Act(c *CreatureEntity, w *World) {
+	if w.InWater(c.Position()) {
+		c.ApplyForce(DragForce(c.Velocity().Sub(w.FlowAt(c.Position())), b.Coeff))
+	}
+}
+
+func (b *DragBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// DepositBehaviour leaves a trail of scent wherever the creature goes
+type DepositBehaviour struct {
+	Channel ScentChannel `json:"channel"`
+	Rate    float64      `json:"rate"` // Amount deposited per second
+}
+
+func (b *DepositBehaviour) Name() string { return "deposit" }
+
+func (b *DepositBehaviour) Act(c *CreatureEntity, w *World) {
+	c.Deposit(b.Channel, b.Rate*FixedPhysicsTimestep)
+}
+
+func (b *DepositBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// AnimateBehaviour plays the left or right animation depending on which way the creature faces,
+// faster the faster it is moving
+type AnimateBehaviour struct {
+	Left  string  `json:"left"`
+	Right string  `json:"right"`
+	Speed float64 `json:"speed"` // Animation speed per unit of velocity
+}
+
+func (b *AnimateBehaviour) Name() string { return "animate" }
+
+func (b *AnimateBehaviour) Act(c *CreatureEntity, w *World) {
+	if math.Cos(c.heading) < 0 {
+		c.anim.SwitchTo(b.Left)
+	} else {
+		c.anim.SwitchTo(b.Right)
+	}
+	c.anim.SetSpeed(b.Speed * math.Max(c.Velocity().Len(), 0.5))
+	c.anim.Step(FixedPhysicsTimestep)
+}
+
+func (b *AnimateBehaviour) Clone() Behaviour { clone := *b; return &clone }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gopxl/pixel"
+)
+
+// WanderBehaviour picks a new random direction to swim in every so often
+type WanderBehaviour struct {
+	Interval float64 `json:"interval"`
+	dir      pixel.Vec
+	lastTime float64
+	started  bool
+}
+
+func (b *WanderBehaviour) Name() string { return "wander" }
+
+func (b *WanderBehaviour) Steer(c *CreatureEntity, w *World) pixel.Vec {
+	if !b.started {
+		b.started, b.lastTime, b.dir = true, c.now, c.Heading()
+	}
+	if c.now-b.lastTime > b.Interval {
+		b.lastTime = c.now
+		b.dir = pixel.Unit(c.rng.Float64() * 2 * math.Pi)
+	}
+	return b.dir
+}
+
+func (b *WanderBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// SeekBehaviour swims towards the nearest perceived entity with a tag, such as prey or food
+type SeekBehaviour struct {
+	Tag    string  `json:"tag"`
+	Radius float64 `json:"radius"` // Distance within which targets are noticed
+}
+
+func (b *SeekBehaviour) Name() string { return "seek" }
+
+func (b *SeekBehaviour) Steer(c *CreatureEntity, w *World) pixel.Vec {
+	target, ok := c.perception.Nearest(b.Tag, b.Radius)
+	if !ok {
+		return pixel.ZV
+	}
+	return target.Offset.Unit()
+}
+
+func (b *SeekBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// FleeBehaviour swims away from the nearest perceived entity with a tag, more urgently the closer it is
+type FleeBehaviour struct {
+	Tag    string  `json:"tag"`
+	Radius float64 `json:"radius"` // Distance within which threats are noticed
+}
+
+func (b *FleeBehaviour) Name() string { return "flee" }
+
+func (b *FleeBehaviour) Steer(c *CreatureEntity, w *World) pixel.Vec {
+	threat, ok := c.perception.Nearest(b.Tag, b.Radius)
+	if !ok || threat.Distance == 0 {
+		return pixel.ZV
+	}
+	return threat.Offset.Unit().Scaled(-(1 - threat.Distance/b.Radius))
+}
+
+func (b *FleeBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// FleeSoundBehaviour swims away from the loudest stimulus heard of any of the kinds, more urgently the louder it is
+type FleeSoundBehaviour struct {
+	Kinds []string `json:"kinds"`
+}
+
+func (b *FleeSoundBehaviour) Name() string { return "flee-sound" }
+
+func (b *FleeSoundBehaviour) Steer(c *CreatureEntity, w *World) pixel.Vec {
+	heard, ok := c.perception.Loudest(b.Kinds)
+	if !ok {
+		return pixel.ZV
+	}
+	return heard.Dir.Scaled(-math.Min(heard.Intensity, 1))
+}
+
+func (b *FleeSoundBehaviour) Clone() Behaviour {
+	clone := *b
+	clone.Kinds = append([]string(nil), b.Kinds...)
+	return &clone
+}
+
+// FollowScentBehaviour swims up the gradient of a channel of scent, towards wherever it is strongest,
+// as long as the scent where the creature is can be smelt
+type FollowScentBehaviour struct {
+	Channel ScentChannel `json:"channel"`
+	Above   float64      `json:"above"` // Weakest concentration that can be smelt
+}
+
+func (b *FollowScentBehaviour) Name() string { return "follow-scent" }
+
+func (b *FollowScentBehaviour) Steer(c *CreatureEntity, w *World) pixel.Vec {
+	if w.Scent.At(b.Channel, c.Position()) <= b.Above {
+		return pixel.ZV
+	}
+	if g := w.Scent.Gradient(b.Channel, c.Position()); g != pixel.ZV {
+		return g.Unit()
+	}
+	return pixel.ZV
+}
+
+func (b *FollowScentBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// SeekComfortBehaviour looks at the water a short way off in a circle around the creature, and swims towards
+// wherever is most comfortable for it. It has no opinion while the creature is comfortable where it is.
+type SeekComfortBehaviour struct {
+	Distance float64 `json:"distance"` // How far away to look
+	Rays     int     `json:"rays"`
+}
+
+func (b *SeekComfortBehaviour) Name() string { return "seek-comfort" }
+
+func (b *SeekComfortBehaviour) Steer(c *CreatureEntity, w *World) pixel.Vec {
+	strain := c.def.Tolerances.Strain(c.conditions)
+	if strain == 0 {
+		return pixel.ZV
+	}
+	best, bestStrain := pixel.ZV, strain
+	for i := 0; i < b.Rays; i++ {
+		dir := pixel.Unit(c.heading + 2*math.Pi*float64(i)/float64(b.Rays))
+		// Only consider water that can be swum to directly
+		if hit, _ := w.Map.Raycast(c.Position(), dir, b.Distance); hit {
+			continue
+		}
+		cond, ok := w.Map.ConditionsAt(c.Position().Add(dir.Scaled(b.Distance)))
+		if s := c.def.Tolerances.Strain(cond); ok && s < bestStrain {
+			best, bestStrain = dir, s
+		}
+	}
+	return best
+}
+
+func (b *SeekComfortBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// FlockBehaviour keeps the creature in a school with perceived entities with a tag, by moving away from ones that
+// are too close (separation), swimming the same way as them (alignment), and moving towards their centre (cohesion)
+type FlockBehaviour struct {
+	Tag        string  `json:"tag"`
+	Radius     float64 `json:"radius"`
+	Separation float64 `json:"separation"`
+	Alignment  float64 `json:"alignment"`
+	Cohesion   float64 `json:"cohesion"`
+}
+
+func (b *FlockBehaviour) Name() string { return "flock" }
+
+func (b *FlockBehaviour) Steer(c *CreatureEntity, w *World) pixel.Vec {
+	count := 0
+	separation, alignment, centre := pixel.ZV, pixel.ZV, pixel.ZV
+	c.perception.WithTag(b.Tag, b.Radius, func(p Percept) {
+		if p.Distance == 0 {
+			return
+		}
+		count++
+		separation = separation.Sub(p.Offset.Unit().Scaled(1 - p.Distance/b.Radius))
+		if v := p.Entity.Velocity(); v != pixel.ZV {
+			alignment = alignment.Add(v.Unit())
+		}
+		centre = centre.Add(p.Entity.Position())
+	})
+	if count == 0 {
+		return pixel.ZV
+	}
+	n := float64(count)
+	cohesion := centre.Scaled(1 / n).Sub(c.Position()).Scaled(1 / b.Radius)
+	steer := separation.Scaled(b.Separation / n).
+		Add(alignment.Scaled(b.Alignment / n)).
+		Add(cohesion.Scaled(b.Cohesion))
+	return clampLen(steer, 1)
+}
+
+func (b *FlockBehaviour) Clone() Behaviour { clone := *b; return &clone }
+
+// AvoidTerrainBehaviour casts rays in a fan ahead of the creature, and steers away from any solid texels they hit,
+// more urgently the closer they are
+type AvoidTerrainBehaviour struct {
+	Distance float64 `json:"distance"` // How far ahead to look
+	Rays     int     `json:"rays"`
+	Spread   float64 `json:"spread"` // Angle of the fan in degrees
+}
+
+func (b *AvoidTerrainBehaviour) Name() string { return "avoid-terrain" }
+
+func (b *AvoidTerrainBehaviour) Steer(c *CreatureEntity, w *World) pixel.Vec {
+	steer := pixel.ZV
+	spread := b.Spread * math.Pi / 180
+	for i := 0; i < b.Rays; i++ {
+		angle := c.heading
+		if b.Rays > 1 {
+			angle += spread * (float64(i)/float64(b.Rays-1) - 0.5)
+		}
+		dir := pixel.Unit(angle)
+		if hit, dist := w.Map.Raycast(c.Position(), dir, b.Distance); hit {
+			steer = steer.Sub(dir.Scaled(1 - dist/b.Distance))
+		}
+	}
+	return clampLen(steer, 1)
+}
+
+func (b *AvoidTerrainBehaviour) Clone() Behaviour { clone := *b; return &clone }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gopxl/pixel"
+)
+
+// GridCell is the coordinate of a single cell in a SpatialGrid
+type GridCell [2]int
+
+// SpatialGrid is a uniform grid used to quickly find entities that are close to each other.
+// It stores indexes into the slice of entities it was built from, in ascending order within each cell,
+// so iterating over it is always in the same order for the same entities.
+type SpatialGrid struct {
+	cellSize float64
+	cells    map[GridCell][]int
+	entities []Entity
+}
+
+// NewSpatialGrid creates an empty grid. The cell size will grow to fit the largest entity when it is built.
+func NewSpatialGrid(minCellSize float64) *SpatialGrid {
+	return &SpatialGrid{
+		cellSize: minCellSize,
+		cells:    make(map[GridCell][]int),
+	}
+}
+
+// Build clears the grid and inserts all of the entities at their current positions
+func (g *SpatialGrid) Build(entities []Entity) {
+	for c, indexes := range g.cells {
+		if len(indexes) == 0 {
+			delete(g.cells, c)
+		} else {
+			g.cells[c] = indexes[:0]
+		}
+	}
+	g.entities = entities
+	for _, e := range entities {
+		g.cellSize = math.Max(g.cellSize, e.Radius()*2)
+	}
+	for i, e := range entities {
+		c := g.CellOf(e.Position())
+		g.cells[c] = append(g.cells[c], i)
+	}
+}
+
+// CellSize returns the width of each cell
+func (g *SpatialGrid) CellSize() float64 {
+	return g.cellSize
+}
+
+// CellOf returns the cell that a world position is in
+func (g *SpatialGrid) CellOf(pos pixel.Vec) GridCell {
+	return GridCell{int(math.Floor(pos.X / g.cellSize)), int(math.Floor(pos.Y / g.cellSize))}
+}
+
+// CellRect returns the area of the world covered by a cell
+func (g *SpatialGrid) CellRect(c GridCell) pixel.Rect {
+	min := pixel.V(float64(c[0]), float64(c[1])).Scaled(g.cellSize)
+	return pixel.Rect{Min: min, Max: min.Add(pixel.V(g.cellSize, g.cellSize))}
+}
+
+// OccupiedCells returns the number of entities in each cell that has at least one entity
+func (g *SpatialGrid) OccupiedCells() map[GridCell]int {
+	occupied := make(map[GridCell]int)
+	for c, indexes := range g.cells {
+		if len(indexes) > 0 {
+			occupied[c] = len(indexes)
+		}
+	}
+	return occupied
+}
+
+// Query calls f with the index of every entity that may be within radius of pos.
+// Callers should still check the actual distance.
+func (g *SpatialGrid) Query(pos pixel.Vec, radius float64, f func(i int)) {
+	min, max := g.CellOf(pos.Sub(pixel.V(radius, radius))), g.CellOf(pos.Add(pixel.V(radius, radius)))
+	for cx := min[0]; cx <= max[0]; cx++ {
+		for cy := min[1]; cy <= max[1]; cy++ {
+			for _, i := range g.cells[GridCell{cx, cy}] {
+				f(i)
+			}
+		}
+	}
+}
+
+// CandidatesAfter calls f with every entity index greater than i that may be touching entity i
+func (g *SpatialGrid) CandidatesAfter(i int, f func(j int)) {
+	e := g.entities[i]
+	// Cells are at least as big as the biggest entity, so touching entities are at most one cell away
+	g.Query(e.Position(), g.cellSize, func(j int) {
+		if j > i {
+			f(j)
+		}
+	})
+}
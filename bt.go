@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// BTStatus is the result of ticking a behaviour tree node
+type BTStatus int
+
+const (
+	BTFailure BTStatus = iota
+	BTSuccess
+	BTRunning
+)
+
+func (s BTStatus) String() string {
+	switch s {
+	case BTSuccess:
+		return "success"
+	case BTRunning:
+		return "running"
+	default:
+		return "failure"
+	}
+}
+
+// Blackboard is the memory of a creature's behaviour tree, shared between all of its nodes.
+// Values should be plain values such as numbers and strings, never entities, so that it can be copied safely.
+type Blackboard map[string]any
+
+// Clone returns a copy of the blackboard that can be changed without affecting the original
+func (b Blackboard) Clone() Blackboard {
+	clone := make(Blackboard, len(b))
+	for k, v := range b {
+		clone[k] = v
+	}
+	return clone
+}
+
+// BTContext is everything a node can use while being ticked
+type BTContext struct {
+	Creature   *CreatureEntity
+	World      *World
+	Blackboard Blackboard
+	statuses   map[BTNode]BTStatus
+}
+
+// Tick ticks a child node, remembering its status so it can be inspected. Composites and decorators tick their
+// children with this rather than calling them directly.
+func (ctx *BTContext) Tick(n BTNode) BTStatus {
+	status := n.Tick(ctx)
+	ctx.statuses[n] = status
+	return status
+}
+
+// Brain runs a creature's behaviour tree each step, and remembers what each node did on the last step
+type Brain struct {
+	Root       BTNode
+	Blackboard Blackboard
+	statuses   map[BTNode]BTStatus
+}
+
+// NewBrain creates a brain running the tree with an empty blackboard
+func NewBrain(root BTNode) *Brain {
+	return &Brain{root, make(Blackboard), make(map[BTNode]BTStatus)}
+}
+
+// Tick runs the tree once for the creature
+func (b *Brain) Tick(c *CreatureEntity, w *World) BTStatus {
+	clear(b.statuses)
+	ctx := &BTContext{c, w, b.Blackboard, b.statuses}
+	return ctx.Tick(b.Root)
+}
+
+// Clone returns a copy of the brain with its own tree state and blackboard
+func (b *Brain) Clone() *Brain {
+	return &Brain{b.Root.Clone(), b.Blackboard.Clone(), make(map[BTNode]BTStatus)}
+}
+
+// DebugFields lists every node of the tree, indented by depth, with what it returned on the last step.
+// Nodes that were not reached are shown with a dash.
+func (b *Brain) DebugFields() []DebugField {
+	var fields []DebugField
+	var walk func(n BTNode, depth int)
+	walk = func(n BTNode, depth int) {
+		status := "-"
+		if s, ok := b.statuses[n]; ok {
+			status = s.String()
+		}
+		fields = append(fields, DebugField{strings.Repeat("  ", depth) + n.Name(), status})
+		for _, c := range n.Children() {
+			walk(c, depth+1)
+		}
+	}
+	walk(b.Root, 0)
+	for _, k := range sortedKeys(b.Blackboard) {
+		fields = append(fields, DebugField{"bb." + k, fmt.Sprint(b.Blackboard[k])})
+	}
+	return fields
+}
+
+// BTNode is a node of a behaviour tree. Nodes are created from data, and their exported fields are the
+// parameters read from it. Composites and decorators also hold their children.
+type BTNode interface {
+	Name() string
+	Tick(ctx *BTContext) BTStatus
+	Children() []BTNode
+	Clone() BTNode // Clone returns a copy of the node and its children with their own state
+}
+
+// btNodeHeader is the part of a node definition common to all nodes. The rest of it is the parameters.
+type btNodeHeader struct {
+	Type     string            `json:"type"`
+	Children []json.RawMessage `json:"children"` // For composites
+	Child    json.RawMessage   `json:"child"`    // For decorators
+}
+
+// btNodeTypes creates a node of each type with default parameters, ready for the definition to overwrite
+var btNodeTypes = map[string]func() BTNode{
+	"selector": func() BTNode { return &BTSelector{} },
+	"sequence": func() BTNode { return &BTSequence{} },
+	"invert":   func() BTNode { return &BTInvert{} },
+	"succeed":  func() BTNode { return &BTSucceed{} },
+	"cooldown": func() BTNode { return &BTCooldown{Seconds: 1, last: math.Inf(-1)} },
+	"near":     func() BTNode { return &BTNear{Tag: "predator", Radius: 5} },
+	"dark":     func() BTNode { return &BTDark{Below: 0.1} },
+	"check":    func() BTNode { return &BTCheck{} },
+	"chance":   func() BTNode { return &BTChance{Probability: 0.5} },
+	"set":      func() BTNode { return &BTSet{} },
+	"wait":     func() BTNode { return &BTWait{Seconds: 1} },
+	"use":      func() BTNode { return &BTUse{Speed: 1} },
+	"hear":     func() BTNode { return &BTHear{Kinds: []string{StimulusAlarm}} },
+	"emit":     func() BTNode { return &BTEmit{Kind: StimulusAlarm, Intensity: 3} },
+	"smell":    func() BTNode { return &BTSmell{Channel: ScentFood, Above: 0.01} },
+	"deposit":  func() BTNode { return &BTDeposit{Channel: ScentBlood, Amount: 1} },
+	"tired":    func() BTNode { return &BTTired{Below: 0.5} },
+}
+
+// btCompositeNode is a node with any number of children
+type btCompositeNode interface {
+	addChild(BTNode)
+}
+
+// btDecoratorNode is a node that changes what a single child does
+type btDecoratorNode interface {
+	setChild(BTNode)
+}
+
+// BuildBehaviourTree creates a tree from its data definition
+func BuildBehaviourTree(data json.RawMessage) (BTNode, error) {
+	var header btNodeHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	newNode, ok := btNodeTypes[header.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown behaviour tree node %q", header.Type)
+	}
+	node := newNode()
+	if err := json.Unmarshal(data, node); err != nil {
+		return nil, fmt.Errorf("failed to decode behaviour tree node %s: %w", header.Type, err)
+	}
+	switch n := node.(type) {
+	case btCompositeNode:
+		if len(header.Children) == 0 {
+			return nil, fmt.Errorf("behaviour tree node %s needs children", header.Type)
+		}
+		for _, c := range header.Children {
+			child, err := BuildBehaviourTree(c)
+			if err != nil {
+				return nil, err
+			}
+			n.addChild(child)
+		}
+	case btDecoratorNode:
+		if header.Child == nil {
+			return nil, fmt.Errorf("behaviour tree node %s needs a child", header.Type)
+		}
+		child, err := BuildBehaviourTree(header.Child)
+		if err != nil {
+			return nil, err
+		}
+		n.setChild(child)
+	}
+	return node, nil
+}
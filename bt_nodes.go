@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// btChildren holds the children of a composite node
+type btChildren struct {
+	children []BTNode
+}
+
+func (b *btChildren) addChild(n BTNode)  { b.children = append(b.children, n) }
+func (b *btChildren) Children() []BTNode { return b.children }
+
+func (b btChildren) clone() btChildren {
+	clone := btChildren{make([]BTNode, len(b.children))}
+	for i, c := range b.children {
+		clone.children[i] = c.Clone()
+	}
+	return clone
+}
+
+// btChild holds the child of a decorator node
+type btChild struct {
+	child BTNode
+}
+
+func (b *btChild) setChild(n BTNode)  { b.child = n }
+func (b *btChild) Children() []BTNode { return []BTNode{b.child} }
+func (b btChild) clone() btChild      { return btChild{b.child.Clone()} }
+
+// btLeaf is embedded in nodes without children
+type btLeaf struct{}
+
+func (btLeaf) Children() []BTNode { return nil }
+
+// BTSelector tries each child in order until one does not fail, so earlier children take priority
+type BTSelector struct {
+	btChildren
+}
+
+func (n *BTSelector) Name() string { return "selector" }
+
+func (n *BTSelector) Tick(ctx *BTContext) BTStatus {
+	for _, c := range n.children {
+		if s := ctx.Tick(c); s != BTFailure {
+			return s
+		}
+	}
+	return BTFailure
+}
+
+func (n *BTSelector) Clone() BTNode { return &BTSelector{n.btChildren.clone()} }
+
+// BTSequence runs each child in order until one does not succeed
+type BTSequence struct {
+	btChildren
+}
+
+func (n *BTSequence) Name() string { return "sequence" }
+
+func (n *BTSequence) Tick(ctx *BTContext) BTStatus {
+	for _, c := range n.children {
+		if s := ctx.Tick(c); s != BTSuccess {
+			return s
+		}
+	}
+	return BTSuccess
+}
+
+func (n *BTSequence) Clone() BTNode { return &BTSequence{n.btChildren.clone()} }
+
+// BTInvert turns its child's success into failure and failure into success
+type BTInvert struct {
+	btChild
+}
+
+func (n *BTInvert) Name() string { return "invert" }
+
+func (n *BTInvert) Tick(ctx *BTContext) BTStatus {
+	switch ctx.Tick(n.child) {
+	case BTSuccess:
+		return BTFailure
+	case BTFailure:
+		return BTSuccess
+	}
+	return BTRunning
+}
+
+func (n *BTInvert) Clone() BTNode { return &BTInvert{n.btChild.clone()} }
+
+// BTSucceed runs its child, but always succeeds
+type BTSucceed struct {
+	btChild
+}
+
+func (n *BTSucceed) Name() string { return "succeed" }
+
+func (n *BTSucceed) Tick(ctx *BTContext) BTStatus {
+	ctx.Tick(n.child)
+	return BTSuccess
+}
+
+func (n *BTSucceed) Clone() BTNode { return &BTSucceed{n.btChild.clone()} }
+
+// BTCooldown fails without running its child until some time after the child last succeeded
+type BTCooldown struct {
+	btChild
+	Seconds float64 `json:"seconds"`
+	last    float64
+}
+
+func (n *BTCooldown) Name() string { return fmt.Sprintf("cooldown %gs", n.Seconds) }
+
+func (n *BTCooldown) Tick(ctx *BTContext) BTStatus {
+	now := ctx.World.Time()
+	if now-n.last < n.Seconds {
+		return BTFailure
+	}
+	s := ctx.Tick(n.child)
+	if s == BTSuccess {
+		n.last = now
+	}
+	return s
+}
+
+func (n *BTCooldown) Clone() BTNode {
+	return &BTCooldown{n.btChild.clone(), n.Seconds, n.last}
+}
+
+// BTNear succeeds if the creature perceives another entity with a tag within a radius
+type BTNear struct {
+	btLeaf
+	Tag    string  `json:"tag"`
+	Radius float64 `json:"radius"`
+}
+
+func (n *BTNear) Name() string { return fmt.Sprintf("near %s %gm", n.Tag, n.Radius) }
+
+func (n *BTNear) Tick(ctx *BTContext) BTStatus {
+	if _, ok := ctx.Creature.perception.Nearest(n.Tag, n.Radius); ok {
+		return BTSuccess
+	}
+	return BTFailure
+}
+
+func (n *BTNear) Clone() BTNode { clone := *n; return &clone }
+
+// BTDark succeeds if the light where the creature is, is below a level. Caves are completely dark.
+type BTDark struct {
+	btLeaf
+	Below float64 `json:"below"`
+}
+
+func (n *BTDark) Name() string { return fmt.Sprintf("dark < %g", n.Below) }
+
+func (n *BTDark) Tick(ctx *BTContext) BTStatus {
+	if ctx.World.Map.GetLightAt(ctx.Creature.Position()) < n.Below {
+		return BTSuccess
+	}
+	return BTFailure
+}
+
+func (n *BTDark) Clone() BTNode { clone := *n; return &clone }
+
+// BTCheck succeeds if a blackboard value is true, or if it is a number within the bounds given
+type BTCheck struct {
+	btLeaf
+	Key   string   `json:"key"`
+	Above *float64 `json:"above"`
+	Below *float64 `json:"below"`
+}
+
+func (n *BTCheck) Name() string { return "check " + n.Key }
+
+func (n *BTCheck) Tick(ctx *BTContext) BTStatus {
+	switch v := ctx.Blackboard[n.Key].(type) {
+	case bool:
+		if v {
+			return BTSuccess
+		}
+	case float64:
+		if (n.Above == nil || v > *n.Above) && (n.Below == nil || v < *n.Below) {
+			return BTSuccess
+		}
+	}
+	return BTFailure
+}
+
+func (n *BTCheck) Clone() BTNode { clone := *n; return &clone }
+
+// BTChance succeeds randomly with a probability, using the creature's random numbers so it is deterministic
+type BTChance struct {
+	btLeaf
+	Probability float64 `json:"probability"`
+}
+
+func (n *BTChance) Name() string { return fmt.Sprintf("chance %g", n.Probability) }
+
+func (n *BTChance) Tick(ctx *BTContext) BTStatus {
+	if ctx.Creature.rng.Float64() < n.Probability {
+		return BTSuccess
+	}
+	return BTFailure
+}
+
+func (n *BTChance) Clone() BTNode { clone := *n; return &clone }
+
+// BTSet writes a value to the blackboard and succeeds
+type BTSet struct {
+	btLeaf
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+func (n *BTSet) Name() string { return fmt.Sprintf("set %s=%v", n.Key, n.Value) }
+
+func (n *BTSet) Tick(ctx *BTContext) BTStatus {
+	ctx.Blackboard[n.Key] = n.Value
+	return BTSuccess
+}
+
+func (n *BTSet) Clone() BTNode { clone := *n; return &clone }
+
+// BTWait keeps running for a time on the simulation clock, then succeeds. If it stops being ticked before it
+// finishes, the wait starts again the next time it is reached.
+type BTWait struct {
+	btLeaf
+	Seconds  float64 `json:"seconds"`
+	start    float64
+	lastTick int
+	waiting  bool
+}
+
+func (n *BTWait) Name() string { return fmt.Sprintf("wait %gs", n.Seconds) }
+
+func (n *BTWait) Tick(ctx *BTContext) BTStatus {
+	tick := ctx.World.Tick
+	if !n.waiting || n.lastTick != tick-1 {
+		n.waiting, n.start = true, ctx.World.Time()
+	}
+	n.lastTick = tick
+	if ctx.World.Time()-n.start >= n.Seconds {
+		n.waiting = false
+		return BTSuccess
+	}
+	return BTRunning
+}
+
+func (n *BTWait) Clone() BTNode { clone := *n; return &clone }
+
+// BTUse chooses which of the creature's steering behaviours are used, and how fast it swims, then succeeds.
+// This is how the tree puts a creature into a state such as fleeing, schooling or resting.
+// An empty list of behaviours uses all of them.
+type BTUse struct {
+	btLeaf
+	Behaviours []string `json:"behaviours"`
+	Speed      float64  `json:"speed"` // Multiplier for the creature's thrust
+}
+
+func (n *BTUse) Name() string {
+	return fmt.Sprintf("use %s x%g", strings.Join(n.Behaviours, "+"), n.Speed)
+}
+
+func (n *BTUse) Tick(ctx *BTContext) BTStatus {
+	ctx.Creature.Use(n.Behaviours, n.Speed)
+	return BTSuccess
+}
+
+func (n *BTUse) Clone() BTNode { clone := *n; return &clone }
+
+// BTHear succeeds if the creature heard a stimulus of any of the kinds louder than a level on this step
+type BTHear struct {
+	btLeaf
+	Kinds []string `json:"kinds"`
+	Above float64  `json:"above"`
+}
+
+func (n *BTHear) Name() string {
+	return fmt.Sprintf("hear %s > %g", strings.Join(n.Kinds, "/"), n.Above)
+}
+
+func (n *BTHear) Tick(ctx *BTContext) BTStatus {
+	if h, ok := ctx.Creature.perception.Loudest(n.Kinds); ok && h.Intensity > n.Above {
+		return BTSuccess
+	}
+	return BTFailure
+}
+
+func (n *BTHear) Clone() BTNode {
+	clone := *n
+	clone.Kinds = append([]string(nil), n.Kinds...)
+	return &clone
+}
+
+// BTEmit makes a stimulus at the creature's position and succeeds. Put it behind a cooldown to avoid making one every step.
+type BTEmit struct {
+	btLeaf
+	Kind      string  `json:"kind"`
+	Intensity float64 `json:"intensity"`
+}
+
+func (n *BTEmit) Name() string { return fmt.Sprintf("emit %s %g", n.Kind, n.Intensity) }
+
+func (n *BTEmit) Tick(ctx *BTContext) BTStatus {
+	ctx.Creature.Emit(n.Kind, n.Intensity)
+	return BTSuccess
+}
+
+func (n *BTEmit) Clone() BTNode { clone := *n; return &clone }
+
+// BTSmell succeeds if the scent of a channel where the creature is, is above a level
+type BTSmell struct {
+	btLeaf
+	Channel ScentChannel `json:"channel"`
+	Above   float64      `json:"above"`
+}
+
+func (n *BTSmell) Name() string { return fmt.Sprintf("smell %s > %g", n.Channel, n.Above) }
+
+func (n *BTSmell) Tick(ctx *BTContext) BTStatus {
+	if ctx.World.Scent.At(n.Channel, ctx.Creature.Position()) > n.Above {
+		return BTSuccess
+	}
+	return BTFailure
+}
+
+func (n *BTSmell) Clone() BTNode { clone := *n; return &clone }
+
+// BTDeposit leaves an amount of scent at the creature's position and succeeds
+type BTDeposit struct {
+	btLeaf
+	Channel ScentChannel `json:"channel"`
+	Amount  float64      `json:"amount"`
+}
+
+func (n *BTDeposit) Name() string { return fmt.Sprintf("deposit %s %g", n.Channel, n.Amount) }
+
+func (n *BTDeposit) Tick(ctx *BTContext) BTStatus {
+	ctx.Creature.Deposit(n.Channel, n.Amount)
+	return BTSuccess
+}
+
+func (n *BTDeposit) Clone() BTNode { clone := *n; return &clone }
+
+// BTTired succeeds if the creature's energy is below a level
+type BTTired struct {
+	btLeaf
+	Below float64 `json:"below"`
+}
+
+func (n *BTTired) Name() string { return fmt.Sprintf("tired < %g", n.Below) }
+
+func (n *BTTired) Tick(ctx *BTContext) BTStatus {
+	if ctx.Creature.energy < n.Below {
+		return BTSuccess
+	}
+	return BTFailure
+}
+
+func (n *BTTired) Clone() BTNode { clone := *n; return &clone }
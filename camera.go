@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gopxl/pixel"
+)
+
+// Camera describes which part of the world is shown on the screen.
+// It can be moved by the user, or set to follow something, and it will keep itself inside its bounds.
+type Camera struct {
+	Position       pixel.Vec
+	PixelsPerMeter float64
+	settings       *CameraSettings
+	bounds         pixel.Rect
+	hasBounds      bool
+	follow         func() (pixel.Vec, bool)
+	screenRect     pixel.Rect
+}
+
+// NewCamera creates a camera looking at position. The settings are shared, so they may be changed while the camera is in use.
+func NewCamera(position pixel.Vec, pixelsPerMeter float64, settings *CameraSettings) *Camera {
+	return &Camera{
+		Position:       position,
+		PixelsPerMeter: pixelsPerMeter,
+		settings:       settings,
+	}
+}
+
+// SetBounds sets the area of the world the camera should not look outside of
+func (c *Camera) SetBounds(bounds pixel.Rect) {
+	c.bounds = bounds
+	c.hasBounds = true
+}
+
+// Follow makes the camera follow an entity
+func (c *Camera) Follow(e Entity) {
+	c.follow = func() (pixel.Vec, bool) { return e.Position(), true }
+}
+
+// FollowCentroid makes the camera follow the centre of a group of entities, which is found by calling entities every frame
+func (c *Camera) FollowCentroid(entities func() []Entity) {
+	c.follow = func() (pixel.Vec, bool) {
+		es := entities()
+		if len(es) == 0 {
+			return pixel.ZV, false
+		}
+		total := pixel.ZV
+		for _, e := range es {
+			total = total.Add(e.Position())
+		}
+		return total.Scaled(1 / float64(len(es))), true
+	}
+}
+
+// StopFollowing returns the camera to manual control
+func (c *Camera) StopFollowing() {
+	c.follow = nil
+}
+
+// IsFollowing returns whether the camera is currently following something
+func (c *Camera) IsFollowing() bool {
+	return c.follow != nil
+}
+
+// Update moves the camera using the input, follows any target, and keeps the camera in bounds.
+// screenRect is the area of the screen the camera draws to, and dt is the real time since the last update.
+func (c *Camera) Update(input *InputMap, screenRect pixel.Rect, dt float64) {
+	c.screenRect = screenRect
+
+	// Keyboard panning, any manual panning stops following
+	spd := c.settings.MoveSpeed / c.PixelsPerMeter * dt
+	pan := pixel.ZV
+	if input.Pressed(ActionPanUp) {
+		pan = pan.Add(pixel.V(0, spd))
+	} else if input.Pressed(ActionPanDown) {
+		pan = pan.Add(pixel.V(0, -spd))
+	}
+	if input.Pressed(ActionPanLeft) {
+		pan = pan.Add(pixel.V(-spd, 0))
+	} else if input.Pressed(ActionPanRight) {
+		pan = pan.Add(pixel.V(spd, 0))
+	}
+
+	// Mouse drag panning
+	if input.Pressed(ActionDrag) {
+		pan = pan.Add(c.ScreenToWorld(input.MousePreviousPosition()).Sub(c.ScreenToWorld(input.MousePosition())))
+	}
+	if pan != pixel.ZV {
+		c.StopFollowing()
+		c.Position = c.Position.Add(pan)
+	}
+
+	// Keyboard zoom is around the centre of the screen, scroll zoom is around the mouse
+	if input.Pressed(ActionZoomOut) {
+		c.ZoomAt(1/math.Pow(c.settings.ZoomSpeed, dt), c.screenRect.Center())
+	} else if input.Pressed(ActionZoomIn) {
+		c.ZoomAt(math.Pow(c.settings.ZoomSpeed, dt), c.screenRect.Center())
+	}
+	if scroll := input.MouseScroll().Y; scroll != 0 {
+		c.ZoomAt(math.Pow(c.settings.ScrollZoomSpeed, scroll), input.MousePosition())
+	}
+
+	// Smoothly move towards the followed target
+	if c.follow != nil {
+		if target, ok := c.follow(); ok {
+			t := 1.0
+			if c.settings.FollowSmoothing > 0 {
+				t = 1 - math.Exp(-dt/c.settings.FollowSmoothing)
+			}
+			c.Position = pixel.Lerp(c.Position, target, t)
+		}
+	}
+
+	c.clamp()
+}
+
+// ZoomAt multiplies the zoom by scale, keeping the world position under the screen position in the same place
+func (c *Camera) ZoomAt(scale float64, screenPos pixel.Vec) {
+	before := c.ScreenToWorld(screenPos)
+	c.PixelsPerMeter *= scale
+	c.clampZoom()
+	after := c.ScreenToWorld(screenPos)
+	if !c.IsFollowing() {
+		c.Position = c.Position.Add(before.Sub(after))
+	}
+}
+
+// ScreenToWorld converts a position on the screen to a position in the world
+func (c *Camera) ScreenToWorld(screenPos pixel.Vec) pixel.Vec {
+	return screenPos.Sub(c.screenRect.Center()).Scaled(1 / c.PixelsPerMeter).Add(c.Position)
+}
+
+// WorldToScreen converts a position in the world to a position on the screen
+func (c *Camera) WorldToScreen(worldPos pixel.Vec) pixel.Vec {
+	return worldPos.Sub(c.Position).Scaled(c.PixelsPerMeter).Add(c.screenRect.Center())
+}
+
+// VisibleWorldRect returns the area of the world that is currently on the screen
+func (c *Camera) VisibleWorldRect() pixel.Rect {
+	return pixel.Rect{Min: c.ScreenToWorld(c.screenRect.Min), Max: c.ScreenToWorld(c.screenRect.Max)}
+}
+
+// RenderData creates the render data needed to draw the world from this camera to a target
+func (c *Camera) RenderData(target pixel.Target, targetRect pixel.Rect) *RenderData {
+	return &RenderData{
+		Target:         target,
+		TargetRect:     targetRect,
+		CameraWorldPos: c.Position,
+		PixelsPerMeter: c.PixelsPerMeter,
+	}
+}
+
+func (c *Camera) clampZoom() {
+	if c.settings.MinPixelsPerMeter > 0 {
+		c.PixelsPerMeter = math.Max(c.PixelsPerMeter, c.settings.MinPixelsPerMeter)
+	}
+	if c.settings.MaxPixelsPerMeter > 0 {
+		c.PixelsPerMeter = math.Min(c.PixelsPerMeter, c.settings.MaxPixelsPerMeter)
+	}
+}
+
+// clamp keeps the view inside the bounds. If the view is bigger than the bounds, it is centred on them instead.
+func (c *Camera) clamp() {
+	c.clampZoom()
+	if !c.hasBounds || !c.settings.ClampToBounds {
+		return
+	}
+	halfView := c.screenRect.Size().Scaled(0.5 / c.PixelsPerMeter)
+	clampAxis := func(pos, halfView, min, max float64) float64 {
+		if max-min < halfView*2 {
+			return (min + max) / 2
+		}
+		return pixel.Clamp(pos, min+halfView, max-halfView)
+	}
+	c.Position.X = clampAxis(c.Position.X, halfView.X, c.bounds.Min.X, c.bounds.Max.X)
+	c.Position.Y = clampAxis(c.Position.Y, halfView.Y, c.bounds.Min.Y, c.bounds.Max.Y)
+}
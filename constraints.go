@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/imdraw"
+	"golang.org/x/image/colornames"
+)
+
+// Constraint restricts how entities can move relative to each other or the world.
+// Constraints are solved by moving entities directly after the physics step, so with Verlet integration
+// any correction also changes the entity's velocity.
+type Constraint interface {
+	// Solve moves the entities a step towards satisfying the constraint
+	Solve()
+	// DrawDebug draws the constraint to the debug overlay
+	DrawDebug(imd *imdraw.IMDraw, camera *Camera)
+	// Remap returns a copy of the constraint acting on the entities that remap returns instead, used for snapshots
+	Remap(remap func(Entity) Entity) Constraint
+}
+
+// DampedConstraint is an optional interface for constraints that also slow their entities down.
+// Damping depends on velocity, which solving does not change, so it is applied once per step after the constraints
+// have been solved, rather than on every iteration.
+type DampedConstraint interface {
+	Damp()
+}
+
+// inverseMass is how much an entity should move when correcting a constraint. Kinematic entities never move.
+func inverseMass(e Entity) float64 {
+	if e.IsKinematic() {
+		return 0
+	}
+	return 1 / e.Mass()
+}
+
+// correctPair moves a along correction and b against it. The total movement is the length of correction,
+// split between them by their masses.
+func correctPair(a, b Entity, correction pixel.Vec) {
+	wa, wb := inverseMass(a), inverseMass(b)
+	if wa+wb == 0 {
+		return
+	}
+	a.SlideToPosition(a.Position().Add(correction.Scaled(wa / (wa + wb))))
+	b.SlideToPosition(b.Position().Sub(correction.Scaled(wb / (wa + wb))))
+}
+
+// DistanceConstraint keeps two entities between a minimum and maximum distance apart.
+// Use the same min and max for a rigid rod, or a min of 0 for a rope.
+type DistanceConstraint struct {
+	A, B     Entity
+	Min, Max float64
+}
+
+// NewDistanceConstraint creates a rigid rod keeping two entities at their current distance
+func NewDistanceConstraint(a, b Entity) *DistanceConstraint {
+	dist := a.Position().Sub(b.Position()).Len()
+	return &DistanceConstraint{a, b, dist, dist}
+}
+
+func (c *DistanceConstraint) Solve() {
+	delta := c.B.Position().Sub(c.A.Position())
+	dist := delta.Len()
+	if dist == 0 {
+		return
+	}
+	target := pixel.Clamp(dist, c.Min, c.Max)
+	if target == dist {
+		return
+	}
+	correctPair(c.A, c.B, delta.Scaled((dist-target)/dist))
+}
+
+func (c *DistanceConstraint) DrawDebug(imd *imdraw.IMDraw, camera *Camera) {
+	imd.Color = colornames.White
+	imd.Push(camera.WorldToScreen(c.A.Position()), camera.WorldToScreen(c.B.Position()))
+	imd.Line(1)
+}
+
+func (c *DistanceConstraint) Remap(remap func(Entity) Entity) Constraint {
+	return &DistanceConstraint{remap(c.A), remap(c.B), c.Min, c.Max}
+}
+
+// SpringConstraint softly pulls two entities towards a rest length. Stiffness is the fraction (between 0 and 1)
+// of the error corrected each time it is solved, and damping removes that fraction of their relative velocity
+// along the spring every step, however many times it is solved.
+type SpringConstraint struct {
+	A, B       Entity
+	RestLength float64
+	Stiffness  float64
+	Damping    float64
+}
+
+func (c *SpringConstraint) Solve() {
+	delta := c.B.Position().Sub(c.A.Position())
+	dist := delta.Len()
+	if dist == 0 {
+		return
+	}
+	correctPair(c.A, c.B, delta.Scaled((dist-c.RestLength)*c.Stiffness/dist))
+}
+
+// Damp moves the entities towards each other by the part of their velocity that stretches the spring
+func (c *SpringConstraint) Damp() {
+	delta := c.B.Position().Sub(c.A.Position())
+	dist := delta.Len()
+	if dist == 0 {
+		return
+	}
+	dir := delta.Scaled(1 / dist)
+	relVel := c.B.Velocity().Sub(c.A.Velocity()).Dot(dir)
+	correctPair(c.A, c.B, dir.Scaled(relVel*c.Damping*FixedPhysicsTimestep))
+}
+
+func (c *SpringConstraint) DrawDebug(imd *imdraw.IMDraw, camera *Camera) {
+	imd.Color = colornames.Orange
+	imd.Push(camera.WorldToScreen(c.A.Position()), camera.WorldToScreen(c.B.Position()))
+	imd.Line(1)
+}
+
+func (c *SpringConstraint) Remap(remap func(Entity) Entity) Constraint {
+	return &SpringConstraint{remap(c.A), remap(c.B), c.RestLength, c.Stiffness, c.Damping}
+}
+
+// PinConstraint fixes an entity to a point in the world
+type PinConstraint struct {
+	E      Entity
+	Anchor pixel.Vec
+}
+
+// NewPinConstraint pins an entity where it is now
+func NewPinConstraint(e Entity) *PinConstraint {
+	return &PinConstraint{e, e.Position()}
+}
+
+func (c *PinConstraint) Solve() {
+	c.E.SlideToPosition(c.Anchor)
+}
+
+func (c *PinConstraint) DrawDebug(imd *imdraw.IMDraw, camera *Camera) {
+	imd.Color = colornames.Red
+	imd.Push(camera.WorldToScreen(c.Anchor))
+	imd.Circle(3, 0)
+}
+
+func (c *PinConstraint) Remap(remap func(Entity) Entity) Constraint {
+	return &PinConstraint{remap(c.E), c.Anchor}
+}
+
+// AngleLimitConstraint limits how far a joint at B can bend. The angle is measured from the direction A->B
+// to the direction B->C, so 0 is a straight line, and it is kept between Min and Max radians.
+type AngleLimitConstraint struct {
+	A, B, C  Entity
+	Min, Max float64
+}
+
+func (c *AngleLimitConstraint) Solve() {
+	ab := c.B.Position().Sub(c.A.Position())
+	bc := c.C.Position().Sub(c.B.Position())
+	if ab.Len() == 0 || bc.Len() == 0 {
+		return
+	}
+	angle := math.Remainder(bc.Angle()-ab.Angle(), 2*math.Pi)
+	target := pixel.Clamp(angle, c.Min, c.Max)
+	if target == angle {
+		return
+	}
+	// Rotate A and C around B by half of the error each, in opposite directions, weighted by their masses
+	wa, wc := inverseMass(c.A), inverseMass(c.C)
+	if wa+wc == 0 {
+		return
+	}
+	err := angle - target
+	ba := c.A.Position().Sub(c.B.Position())
+	c.A.SlideToPosition(c.B.Position().Add(ba.Rotated(err * wa / (wa + wc))))
+	c.C.SlideToPosition(c.B.Position().Add(bc.Rotated(-err * wc / (wa + wc))))
+}
+
+func (c *AngleLimitConstraint) DrawDebug(imd *imdraw.IMDraw, camera *Camera) {
+	imd.Color = colornames.Magenta
+	imd.Push(camera.WorldToScreen(c.B.Position()))
+	imd.Circle(4, 1)
+}
+
+func (c *AngleLimitConstraint) Remap(remap func(Entity) Entity) Constraint {
+	return &AngleLimitConstraint{remap(c.A), remap(c.B), remap(c.C), c.Min, c.Max}
+}
+
+// NewChain links entities one after another with rods, limiting how far each link can bend if maxBend is above 0.
+// It returns the constraints, which still need adding to a world.
+func NewChain(links []Entity, maxBend float64) []Constraint {
+	var constraints []Constraint
+	for i := 1; i < len(links); i++ {
+		constraints = append(constraints, NewDistanceConstraint(links[i-1], links[i]))
+		if maxBend > 0 && i >= 2 {
+			constraints = append(constraints, &AngleLimitConstraint{links[i-2], links[i-1], links[i], -maxBend, maxBend})
+		}
+	}
+	return constraints
+}
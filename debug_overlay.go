@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/imdraw"
+	"github.com/gopxl/pixel/pixelgl"
+	"github.com/gopxl/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// DebugLayer is a single part of the debug overlay that can be toggled on and off
+type DebugLayer int
+
+const (
+	DebugCollisionCircles DebugLayer = iota
+	DebugVectors
+	DebugBroadPhase
+	DebugNeighbours
+	DebugRaycasts
+	DebugLight
+	DebugConstraints
+	DebugHUD
+	DebugSenses
+	DebugScent
+	numDebugLayers
+)
+
+var debugLayerNames = [numDebugLayers]string{"collision", "vectors", "broad-phase", "neighbours", "raycasts", "light", "constraints", "hud", "senses", "scent"}
+
+// DebugLayerAction is the name of the input action that toggles a layer
+func DebugLayerAction(l DebugLayer) string {
+	return "debug.layer." + debugLayerNames[l]
+}
+
+// debugRaycastCount is the number of rays cast in a circle for the raycasts layer
+const debugRaycastCount = 32
+
+// DebugStats are the measurements of the last frame shown on the HUD
+type DebugStats struct {
+	FrameTime      time.Duration
+	TickTime       time.Duration
+	Entities       int
+	CollisionPairs int
+}
+
+// DebugOverlay draws information about the simulation over the top of the world, to help diagnose problems visually
+type DebugOverlay struct {
+	enabled     bool
+	layers      [numDebugLayers]bool
+	simSettings *SimulationSettings
+	imd         *imdraw.IMDraw
+	txt         *text.Text
+}
+
+// NewDebugOverlay creates a hidden overlay, with the HUD and collision layers turned on for when it is shown
+func NewDebugOverlay(simSettings *SimulationSettings) *DebugOverlay {
+	d := &DebugOverlay{
+		simSettings: simSettings,
+		imd:         imdraw.New(nil),
+		txt:         text.New(pixel.ZV, globalTextAtlas),
+	}
+	d.layers[DebugCollisionCircles] = true
+	d.layers[DebugHUD] = true
+	return d
+}
+
+// HandleInput toggles the overlay and its layers
+func (d *DebugOverlay) HandleInput(input *InputMap) {
+	if input.JustPressed(ActionDebugToggle) {
+		d.enabled = !d.enabled
+	}
+	if !d.enabled {
+		return
+	}
+	for l := range debugLayerNames {
+		if input.JustPressed(DebugLayerAction(DebugLayer(l))) {
+			d.layers[l] = !d.layers[l]
+		}
+	}
+}
+
+// Enabled returns whether the overlay is shown
+func (d *DebugOverlay) Enabled() bool {
+	return d.enabled
+}
+
+// Render draws all enabled layers. Raycasts are cast from focus, or from the mouse if focus is nil.
+func (d *DebugOverlay) Render(win *pixelgl.Window, camera *Camera, world *World, focus Entity, stats DebugStats) {
+	if !d.enabled {
+		return
+	}
+	m, entities, grid := world.Map, world.Entities, world.Grid()
+	d.imd.Clear()
+	visible := camera.VisibleWorldRect()
+	if d.layers[DebugLight] {
+		d.drawLight(camera, m, visible)
+	}
+	if d.layers[DebugScent] {
+		d.drawScent(camera, world.Scent, visible)
+	}
+	if d.layers[DebugBroadPhase] {
+		d.drawBroadPhase(camera, grid, visible)
+	}
+	if d.layers[DebugNeighbours] {
+		d.drawNeighbours(camera, entities, grid, visible)
+	}
+	if d.layers[DebugVectors] && world.Fluid != nil {
+		d.drawFlow(camera, world.Fluid, visible)
+	}
+	for _, e := range entities.All() {
+		if !visible.Contains(e.Position()) {
+			continue
+		}
+		screenPos := camera.WorldToScreen(e.Position())
+		if d.layers[DebugCollisionCircles] {
+			d.imd.Color = colornames.Lime
+			if e.IsKinematic() {
+				d.imd.Color = colornames.Orange
+			}
+			d.imd.Push(screenPos)
+			d.imd.Circle(e.Radius()*camera.PixelsPerMeter, 1)
+		}
+		if d.layers[DebugVectors] {
+			d.line(colornames.Cyan, screenPos, camera.WorldToScreen(e.Position().Add(e.Velocity())))
+			d.line(colornames.Red, screenPos, camera.WorldToScreen(e.Position().Add(e.Acceleration().Scaled(e.Mass()*0.25))))
+		}
+	}
+	if d.layers[DebugConstraints] {
+		for _, c := range world.Constraints {
+			c.DrawDebug(d.imd, camera)
+		}
+	}
+	if d.layers[DebugRaycasts] {
+		origin := camera.ScreenToWorld(win.MousePosition())
+		if focus != nil {
+			origin = focus.Position()
+		}
+		d.drawRaycasts(camera, m, origin)
+	}
+	if d.layers[DebugSenses] {
+		d.drawStimuli(camera, world.Stimuli(), visible)
+		if p, ok := focus.(Perceiver); ok {
+			d.drawPerception(camera, p.Perception())
+		}
+	}
+	d.imd.Draw(win)
+	if d.layers[DebugHUD] {
+		d.drawHUD(win, stats)
+	}
+}
+
+func (d *DebugOverlay) line(col color.Color, a, b pixel.Vec) {
+	d.imd.Color = col
+	d.imd.Push(a, b)
+	d.imd.Line(1)
+}
+
+// drawLight shades every visible texel by its light level, skipping texels when zoomed out so it stays fast
+func (d *DebugOverlay) drawLight(camera *Camera, m *Map, visible pixel.Rect) {
+	bounds := m.Bounds()
+	minX, maxX := int(math.Max(math.Floor(visible.Min.X), 0)), int(math.Min(math.Ceil(visible.Max.X), bounds.Max.X))
+	minY, maxY := int(math.Max(math.Floor(visible.Min.Y), 0)), int(math.Min(math.Ceil(visible.Max.Y), bounds.Max.Y))
+	stride := int(math.Max(1, math.Ceil(math.Max(visible.W(), visible.H())/128)))
+	half := pixel.V(float64(stride), float64(stride)).Scaled(0.5)
+	for tx := minX; tx <= maxX; tx += stride {
+		for ty := minY; ty <= maxY; ty += stride {
+			pos := pixel.V(float64(tx), float64(ty))
+			light := m.GetLightAt(pos)
+			d.imd.Color = pixel.RGBA{R: light * 0.5, G: light * 0.5, A: 0.5}
+			d.imd.Push(camera.WorldToScreen(pos.Sub(half)), camera.WorldToScreen(pos.Add(half)))
+			d.imd.Rectangle(0)
+		}
+	}
+}
+
+// scentColours are the colour each scent channel is shown in on the heatmap
+var scentColours = [numScentChannels]pixel.RGBA{
+	ScentFood:      {G: 1, A: 1},
+	ScentBlood:     {R: 1, A: 1},
+	ScentPheromone: {B: 1, A: 1},
+}
+
+// drawScent shades every visible water texel with scent in it, mixing the colour of each channel by how strong it is.
+// Texels are skipped when zoomed out, like the light layer.
+func (d *DebugOverlay) drawScent(camera *Camera, scent *ScentField, visible pixel.Rect) {
+	bounds := scent.Bounds()
+	minX, maxX := int(math.Max(math.Floor(visible.Min.X), 0)), int(math.Min(math.Ceil(visible.Max.X), bounds.Max.X))
+	minY, maxY := int(math.Max(math.Floor(visible.Min.Y), 0)), int(math.Min(math.Ceil(visible.Max.Y), bounds.Max.Y))
+	stride := int(math.Max(1, math.Ceil(math.Max(visible.W(), visible.H())/128)))
+	half := pixel.V(float64(stride), float64(stride)).Scaled(0.5)
+	for tx := minX; tx <= maxX; tx += stride {
+		for ty := minY; ty <= maxY; ty += stride {
+			pos := pixel.V(float64(tx), float64(ty))
+			col, strongest := pixel.RGBA{}, 0.0
+			for c := ScentChannel(0); c < numScentChannels; c++ {
+				if !scent.Active(c) {
+					continue
+				}
+				// Scent fades out over several orders of magnitude, so show faint scent too
+				strength := 1 - math.Exp(-scent.At(c, pos)*20)
+				col = col.Add(scentColours[c].Scaled(strength))
+				strongest = math.Max(strongest, strength)
+			}
+			if strongest < 0.02 {
+				continue
+			}
+			col.A = 0.6 * strongest
+			d.imd.Color = col
+			d.imd.Push(camera.WorldToScreen(pos.Sub(half)), camera.WorldToScreen(pos.Add(half)))
+			d.imd.Rectangle(0)
+		}
+	}
+}
+
+// drawFlow draws the velocity of every visible water cell of the fluid, from the cell's centre
+func (d *DebugOverlay) drawFlow(camera *Camera, fluid *FluidField, visible pixel.Rect) {
+	fluid.CellCentres(visible, func(centre, vel pixel.Vec) {
+		if vel.Len() > 0.01 {
+			d.line(colornames.Steelblue, camera.WorldToScreen(centre), camera.WorldToScreen(centre.Add(vel)))
+		}
+	})
+}
+
+// drawBroadPhase outlines every visible occupied grid cell, getting brighter the more entities are in it
+func (d *DebugOverlay) drawBroadPhase(camera *Camera, grid *SpatialGrid, visible pixel.Rect) {
+	for c, count := range grid.OccupiedCells() {
+		r := grid.CellRect(c)
+		if r.Intersect(visible).Area() == 0 {
+			continue
+		}
+		d.imd.Color = pixel.RGBA{R: 1, B: 1, A: math.Min(1, 0.2+float64(count)*0.1)}
+		d.imd.Push(camera.WorldToScreen(r.Min), camera.WorldToScreen(r.Max))
+		d.imd.Rectangle(1)
+	}
+}
+
+// drawNeighbours links every visible fish to the other fish within its neighbour radius
+func (d *DebugOverlay) drawNeighbours(camera *Camera, entities *EntitiesContainer, grid *SpatialGrid, visible pixel.Rect) {
+	radius := d.simSettings.FishSettings.NeighbourRadius
+	all := entities.All()
+	d.imd.Color = pixel.RGBA{R: 1, G: 1, B: 1, A: 0.3}
+	for i, e := range all {
+		if !visible.Contains(e.Position()) || !HasTag(e, "fish") {
+			continue
+		}
+		grid.Query(e.Position(), radius, func(j int) {
+			other := all[j]
+			if j > i && other.Position().Sub(e.Position()).Len() < radius && HasTag(other, "fish") {
+				d.imd.Push(camera.WorldToScreen(e.Position()), camera.WorldToScreen(other.Position()))
+				d.imd.Line(1)
+			}
+		})
+	}
+}
+
+// drawRaycasts casts rays against the map in a circle around the origin, red rays hit something
+func (d *DebugOverlay) drawRaycasts(camera *Camera, m *Map, origin pixel.Vec) {
+	const maxDist = 20
+	for i := 0; i < debugRaycastCount; i++ {
+		dir := pixel.Unit(float64(i) / debugRaycastCount * 2 * math.Pi)
+		hit, dist := m.Raycast(origin, dir, maxDist)
+		col := color.Color(colornames.Yellow)
+		if hit {
+			col = colornames.Red
+		}
+		d.line(col, camera.WorldToScreen(origin), camera.WorldToScreen(origin.Add(dir.Scaled(dist))))
+	}
+}
+
+// drawPerception outlines what an entity can sense, and links it to everything it perceived on its last step.
+// Seen entities are green, entities only felt by the lateral line are blue, and stimuli heard are magenta.
+func (d *DebugOverlay) drawPerception(camera *Camera, p *Perception) {
+	if p.Senses == nil {
+		return
+	}
+	origin := camera.WorldToScreen(p.Origin)
+	halfFOV := p.Senses.FieldOfView * math.Pi / 360
+	const arcSegments = 24
+	d.imd.Color = pixel.RGBA{G: 1, A: 0.5}
+	if halfFOV < math.Pi {
+		d.imd.Push(origin)
+	}
+	for i := 0; i <= arcSegments; i++ {
+		angle := p.Heading - halfFOV + 2*halfFOV*float64(i)/arcSegments
+		d.imd.Push(camera.WorldToScreen(p.Origin.Add(pixel.Unit(angle).Scaled(p.VisionRange))))
+	}
+	if halfFOV < math.Pi {
+		d.imd.Push(origin)
+	}
+	d.imd.Line(1)
+	d.imd.Color = pixel.RGBA{B: 1, A: 0.5}
+	d.imd.Push(origin)
+	d.imd.Circle(p.Senses.LateralRange*camera.PixelsPerMeter, 1)
+	for _, t := range p.Terrain {
+		col := color.Color(colornames.Yellow)
+		if t.Hit {
+			col = colornames.Red
+		}
+		d.line(col, origin, camera.WorldToScreen(p.Origin.Add(t.Dir.Scaled(t.Distance))))
+	}
+	for _, pc := range p.Entities {
+		col := color.Color(colornames.Lime)
+		if !pc.Seen {
+			col = colornames.Deepskyblue
+		}
+		d.line(col, origin, camera.WorldToScreen(pc.Entity.Position()))
+	}
+	for _, h := range p.Heard {
+		d.line(colornames.Magenta, origin, camera.WorldToScreen(p.Origin.Add(h.Dir.Scaled(h.Distance))))
+	}
+}
+
+// drawStimuli rings every stimulus that can be heard this step, out to where it is heard at an intensity of 1
+func (d *DebugOverlay) drawStimuli(camera *Camera, stimuli []Stimulus, visible pixel.Rect) {
+	for _, s := range stimuli {
+		if !visible.Contains(s.Source) {
+			continue
+		}
+		switch s.Kind {
+		case StimulusAlarm:
+			d.imd.Color = colornames.Red
+		case StimulusSplash:
+			d.imd.Color = colornames.White
+		case StimulusFeeding:
+			d.imd.Color = colornames.Yellowgreen
+		default:
+			d.imd.Color = colornames.Yellow
+		}
+		d.imd.Push(camera.WorldToScreen(s.Source))
+		d.imd.Circle(s.Intensity*camera.PixelsPerMeter, 1)
+	}
+}
+
+// drawHUD writes the stats and the layer toggles in the top right of the window
+func (d *DebugOverlay) drawHUD(win *pixelgl.Window, stats DebugStats) {
+	d.txt.Clear()
+	d.txt.Color = colornames.White
+	fps := 0.0
+	if stats.FrameTime > 0 {
+		fps = 1 / stats.FrameTime.Seconds()
+	}
+	fmt.Fprintf(d.txt, "fps:      %.0f (%.1fms)\n", fps, float64(stats.FrameTime.Microseconds())/1000)
+	fmt.Fprintf(d.txt, "tick:     %.2fms\n", float64(stats.TickTime.Microseconds())/1000)
+	fmt.Fprintf(d.txt, "entities: %d\n", stats.Entities)
+	fmt.Fprintf(d.txt, "contacts: %d\n", stats.CollisionPairs)
+	for l, name := range debugLayerNames {
+		state := "off"
+		if d.layers[l] {
+			state = "on"
+		}
+		fmt.Fprintf(d.txt, "[%d] %-11s %s\n", l+1, name, state)
+	}
+	topRight := pixel.V(win.Bounds().Max.X-d.txt.Bounds().W()-5, win.Bounds().Max.Y-5-globalTextAtlas.Ascent())
+	d.txt.Draw(win, pixel.IM.Moved(topRight))
+}
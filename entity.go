@@ -1,6 +1,11 @@
 package main
 
-import "github.com/gopxl/pixel"
+import (
+	"math"
+	"slices"
+
+	"github.com/gopxl/pixel"
+)
 
 // FixedPhysicsTimestep specifies the deltatime to be used.
 // Slow framerate will not modify this.
@@ -9,10 +14,12 @@ const FixedPhysicsTimestep = 1.0 / 60.0
 // Entity is an interface describing all the behaviour an entity should have.
 // All entities have physics, but you can choose to disable it using IsKinematic.
 // All entities should also be able to be rendered.
+// StepLogic is called concurrently for all entities, so it may read from other entities in the world but only write to itself.
 type Entity interface {
 	Renderable
 
 	Position() pixel.Vec
+	PreviousPosition() pixel.Vec // Where the entity was at the start of the last physics step
 	Velocity() pixel.Vec
 	Acceleration() pixel.Vec
 	Mass() float64
@@ -22,9 +29,27 @@ type Entity interface {
 	SlideToPosition(pixel.Vec)
 	SetVelocity(pixel.Vec)
 	StepPhysics()
-	StepLogic()
+	StepLogic(*World)
 	IsKinematic() bool
 	Tags() []string // Tags should stay the same after initialisation
+	Clone() Entity  // Clone returns a copy with its own state, used for snapshots
+}
+
+// EntityReferencer is an optional interface for entities that hold references to other entities.
+// After cloning, the references are swapped for the clones of the entities they referred to.
+type EntityReferencer interface {
+	RemapEntities(remap func(Entity) Entity)
+}
+
+// DebugInspectable is an optional interface for entities that can describe their behaviour-specific state when inspected
+type DebugInspectable interface {
+	DebugFields() []DebugField
+}
+
+// DebugField is a single named value shown when inspecting an entity
+type DebugField struct {
+	Name  string
+	Value string
 }
 
 // EntityBase is a useful implementation of the physics for an entity, for use with composition.
@@ -57,6 +82,10 @@ func (p *EntityBase) Position() pixel.Vec {
 	return p.currentPosition
 }
 
+func (p *EntityBase) PreviousPosition() pixel.Vec {
+	return p.previousPosition
+}
+
 func (p *EntityBase) Velocity() pixel.Vec {
 	return p.recentVelocity
 }
@@ -129,6 +158,23 @@ func (ec *EntitiesContainer) Add(e Entity) {
 	}
 }
 
+// Remove takes an entity out of the container, keeping the order of the rest. It returns whether the entity was found.
+// Entities must not be removed while the world is stepping.
+func (ec *EntitiesContainer) Remove(e Entity) bool {
+	i := slices.Index(ec.allEntities, e)
+	if i < 0 {
+		return false
+	}
+	ec.allEntities = slices.Delete(ec.allEntities, i, i+1)
+	for _, t := range e.Tags() {
+		tagged := ec.taggedEntities[t]
+		if j := slices.Index(tagged, e); j >= 0 {
+			ec.taggedEntities[t] = slices.Delete(tagged, j, j+1)
+		}
+	}
+	return true
+}
+
 func (ec *EntitiesContainer) All() []Entity {
 	return ec.allEntities
 }
@@ -136,3 +182,27 @@ func (ec *EntitiesContainer) All() []Entity {
 func (ec *EntitiesContainer) WithTag(tag string) []Entity {
 	return ec.taggedEntities[tag]
 }
+
+// AtPoint returns the entity at a world position, or nil if there is none.
+// If multiple entities overlap the point, the one whose centre is closest is returned.
+func (ec *EntitiesContainer) AtPoint(pos pixel.Vec) Entity {
+	var closest Entity
+	closestDist := math.Inf(1)
+	for _, e := range ec.allEntities {
+		dist := e.Position().Sub(pos).Len()
+		if dist <= e.Radius() && dist < closestDist {
+			closest, closestDist = e, dist
+		}
+	}
+	return closest
+}
+
+// HasTag returns whether an entity has a tag
+func HasTag(e Entity, tag string) bool {
+	for _, t := range e.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/gopxl/pixel"
+)
+
+// CreatureEntity is an entity built from an EntityDef. Its steering behaviours decide where it wants to go,
+// it turns to face that way, and then its actuators push it around.
+type CreatureEntity struct {
+	EntityBase
+	stimulusBuffer
+	scentBuffer
+	def         *EntityDef
+	behaviours  []weightedBehaviour
+	arbitration ArbitrationPolicy
+	suggestions []pixel.Vec // Suggestions from each steering behaviour in the last step
+	weights     []float64
+	brain       *Brain  // Optional behaviour tree choosing what the creature does
+	active      []bool  // Which behaviours are currently in use, chosen by the brain
+	speed       float64 // Multiplier for thrust, chosen by the brain
+	anim        *Animator
+	col         color.Color
+	heading     float64   // Angle the creature is facing
+	desired     pixel.Vec // Direction the creature wants to face, from the combined steering
+	perception  Perception
+	conditions  Conditions // Conditions of the water the creature was last in
+	energy      float64
+	rng         RNG
+	now         float64
+}
+
+// NewCreature creates a creature from a definition, with all of its randomness coming from seed
+func NewCreature(def *EntityDef, pos pixel.Vec, seed int64) (*CreatureEntity, error) {
+	behaviours, err := def.buildBehaviours()
+	if err != nil {
+		return nil, err
+	}
+	arbitration, err := GetArbitrationPolicy(def.Arbitration)
+	if err != nil {
+		return nil, err
+	}
+	var weights []float64
+	for _, b := range behaviours {
+		if _, ok := b.Behaviour.(Steering); ok {
+			weights = append(weights, b.weight)
+		}
+	}
+	var brain *Brain
+	if def.Brain != nil {
+		root, err := BuildBehaviourTree(def.Brain)
+		if err != nil {
+			return nil, err
+		}
+		brain = NewBrain(root)
+	}
+	active := make([]bool, len(behaviours))
+	for i := range active {
+		active[i] = true
+	}
+	rng := NewRNG(seed)
+	anim := NewAtlasAnimator(def.Atlas)
+	anim.Play(def.Animation)
+	var col color.Color = pixel.RGB(rng.Float64(), rng.Float64(), rng.Float64())
+	if def.Colour != nil {
+		col = pixel.RGB(def.Colour[0], def.Colour[1], def.Colour[2])
+	}
+	heading := rng.Float64() * 2 * math.Pi
+	return &CreatureEntity{
+		EntityBase:  *NewEntityBase(pos, def.Mass, def.Radius),
+		def:         def,
+		behaviours:  behaviours,
+		arbitration: arbitration,
+		suggestions: make([]pixel.Vec, len(weights)),
+		weights:     weights,
+		brain:       brain,
+		active:      active,
+		speed:       1,
+		anim:        anim,
+		col:         col,
+		heading:     heading,
+		desired:     pixel.Unit(heading),
+		energy:      1,
+		rng:         rng,
+	}, nil
+}
+
+func (e *CreatureEntity) Render(rd *RenderData) {
+	s := e.anim.CurrentSprite()
+	if s == nil {
+		return
+	}
+	tmat := pixel.IM.Scaled(pixel.ZV, e.Radius()*2/s.Frame().W())
+	rotAngle := e.heading
+	if math.Cos(e.heading) < 0 {
+		rotAngle += math.Pi
+	}
+	tmat = tmat.Rotated(pixel.ZV, rotAngle)
+	tmat = tmat.Moved(e.Position().Sub(rd.CameraWorldPos))
+	tmat = tmat.Scaled(pixel.ZV, rd.PixelsPerMeter)
+	tmat = tmat.Moved(rd.TargetRect.Bounds().Center())
+	s.DrawColorMask(rd.Target, tmat, e.col)
+}
+
+// StepLogic senses the surroundings, uses or regains energy depending on how comfortable the water is, lets the
+// brain choose which behaviours to use, combines the steering behaviours in use to turn the creature, then runs
+// the actuators in order.
+// If no steering behaviour has an opinion, the creature keeps heading where it last wanted to go.
+func (e *CreatureEntity) StepLogic(w *World) {
+	e.now = w.Time()
+	e.def.Senses.Sense(e, e.heading, w, &e.perception)
+	// Keep the last conditions if pushed into a solid texel for a moment, rather than having none
+	if c, ok := w.Map.ConditionsAt(e.Position()); ok {
+		e.conditions = c
+	}
+	if drain := e.def.Tolerances.Drain(e.conditions); drain > 0 {
+		e.energy = math.Max(e.energy-drain*FixedPhysicsTimestep, 0)
+	} else {
+		e.energy = math.Min(e.energy+e.def.Recovery*FixedPhysicsTimestep, 1)
+	}
+	if e.brain != nil {
+		e.brain.Tick(e, w)
+	}
+	i := 0
+	for bi, b := range e.behaviours {
+		if s, ok := b.Behaviour.(Steering); ok {
+			e.suggestions[i] = pixel.ZV
+			if e.active[bi] {
+				e.suggestions[i] = s.Steer(e, w)
+			}
+			i++
+		}
+	}
+	if steer := e.arbitration(e.suggestions, e.weights); steer.Len() > steeringThreshold {
+		e.desired = steer.Unit()
+	}
+	maxRot := e.def.TurnSpeed * FixedPhysicsTimestep
+	turn := pixel.Clamp(math.Remainder(e.desired.Angle()-e.heading, 2*math.Pi), -maxRot, maxRot)
+	e.heading = math.Remainder(e.heading+turn, 2*math.Pi)
+	for _, b := range e.behaviours {
+		if a, ok := b.Behaviour.(Actuator); ok {
+			a.Act(e, w)
+		}
+	}
+}
+
+// Use chooses which steering behaviours are used by name, and the multiplier for thrust.
+// Actuators are always used. An empty list of names uses every behaviour.
+func (e *CreatureEntity) Use(names []string, speed float64) {
+	for i, b := range e.behaviours {
+		_, steers := b.Behaviour.(Steering)
+		e.active[i] = !steers || len(names) == 0 || slices.Contains(names, b.Name())
+	}
+	e.speed = speed
+}
+
+// Emit makes a stimulus at the creature's position, to be heard by others on the next step
+func (e *CreatureEntity) Emit(kind string, intensity float64) {
+	e.emit(Stimulus{kind, e.Position(), intensity, e})
+}
+
+// Deposit leaves scent at the creature's position, to be smelt by others on the next step
+func (e *CreatureEntity) Deposit(channel ScentChannel, amount float64) {
+	e.deposit(ScentDeposit{channel, e.Position(), amount})
+}
+
+// Heading returns the direction the creature is facing as a unit vector
+func (e *CreatureEntity) Heading() pixel.Vec {
+	return pixel.Unit(e.heading)
+}
+
+// Energy returns how much energy the creature has left, between 0 and 1
+func (e *CreatureEntity) Energy() float64 {
+	return e.energy
+}
+
+// Perception returns what the creature perceived on its last step
+func (e *CreatureEntity) Perception() *Perception {
+	return &e.perception
+}
+
+// Def returns the definition the creature was built from
+func (e *CreatureEntity) Def() *EntityDef {
+	return e.def
+}
+
+func (e *CreatureEntity) Tags() []string { return e.def.Tags }
+
+func (e *CreatureEntity) Clone() Entity {
+	clone := *e
+	clone.anim = e.anim.Clone()
+	clone.behaviours = make([]weightedBehaviour, len(e.behaviours))
+	for i, b := range e.behaviours {
+		clone.behaviours[i] = weightedBehaviour{b.Clone(), b.weight}
+	}
+	clone.suggestions = append([]pixel.Vec(nil), e.suggestions...)
+	clone.active = append([]bool(nil), e.active...)
+	if e.brain != nil {
+		clone.brain = e.brain.Clone()
+	}
+	clone.perception.Clear()
+	clone.stimulusBuffer = stimulusBuffer{}
+	clone.scentBuffer = scentBuffer{}
+	return &clone
+}
+
+// DebugFields shows the suggestion of each steering behaviour as its strength and direction
+func (e *CreatureEntity) DebugFields() []DebugField {
+	fields := []DebugField{
+		{"species", e.def.Name},
+		{"animation", fmt.Sprintf("%s (%.2f)", e.anim.Current(), e.anim.NormalisedTime())},
+		{"heading", fmt.Sprintf("%.1f deg", e.heading*180/math.Pi)},
+		{"desired", fmt.Sprintf("%.1f deg", e.desired.Angle()*180/math.Pi)},
+		{"energy", fmt.Sprintf("%.2f", e.energy)},
+		{"conditions", e.conditions.String()},
+	}
+	var actuators []string
+	i := 0
+	for bi, b := range e.behaviours {
+		if _, ok := b.Behaviour.(Steering); ok {
+			s := e.suggestions[i]
+			value := "off"
+			if e.active[bi] {
+				value = fmt.Sprintf("%.2f x%.1f at %.1f deg", s.Len(), b.weight, s.Angle()*180/math.Pi)
+			}
+			fields = append(fields, DebugField{b.Name(), value})
+			i++
+		} else {
+			actuators = append(actuators, b.Name())
+		}
+	}
+	fields = append(fields, DebugField{"actuators", strings.Join(actuators, ", ")})
+	fields = append(fields, e.perception.DebugFields()...)
+	if e.brain != nil {
+		fields = append(fields, DebugField{"speed", fmt.Sprintf("x%g", e.speed)})
+		fields = append(fields, e.brain.DebugFields()...)
+	}
+	return fields
+}
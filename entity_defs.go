@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gopxl/pixel"
+)
+
+// EntityDefsDir is the directory that entity definitions are loaded from. Each definition is registered as an entity type.
+var EntityDefsDir = path.Join(".", "data", "entities")
+
+// EntityDef describes a type of creature in data, so new species can be added without writing code.
+// The creature's steering behaviours are combined by the arbitration policy to decide which way it turns,
+// then its actuators run in the order they are listed.
+type EntityDef struct {
+	Name        string            `json:"name"`
+	Mass        float64           `json:"mass"`
+	Radius      float64           `json:"radius"`
+	TurnSpeed   float64           `json:"turn-speed"` // Radians per second the creature can turn towards where it wants to go
+	Tags        []string          `json:"tags"`
+	Atlas       string            `json:"atlas"`
+	Animation   string            `json:"animation"`   // Animation to start playing when spawned
+	Colour      []float64         `json:"colour"`      // RGB colour between 0 and 1, or a random colour if left out
+	Arbitration string            `json:"arbitration"` // How steering is combined: weighted-sum (the default), priority or truncation
+	Senses      Senses            `json:"senses"`      // What the creature perceives, which is all its behaviours know about other entities
+	Tolerances  Tolerances        `json:"tolerances"`  // Conditions the creature is comfortable in, outside of which it loses energy
+	Recovery    float64           `json:"recovery"`    // Energy regained per second while comfortable, out of a full store of 1
+	Behaviours  []json.RawMessage `json:"behaviours"`
+	Brain       json.RawMessage   `json:"brain"` // Optional behaviour tree, choosing which behaviours are used
+}
+
+// behaviourHeader is the part of a behaviour definition common to all behaviours. The rest of it is the parameters.
+type behaviourHeader struct {
+	Type   string   `json:"type"`
+	Weight *float64 `json:"weight"` // How much the behaviour's steering counts, 1 if left out
+}
+
+func init() {
+	loadResources()
+	entries, err := os.ReadDir(EntityDefsDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load entity definitions:", err)
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		// A bad definition only loses that one entity type, rather than stopping everything else from running
+		def, err := LoadEntityDef(path.Join(EntityDefsDir, e.Name()))
+		if err == nil {
+			err = RegisterEntityDef(def)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "skipping entity definition:", err)
+		}
+	}
+}
+
+// LoadEntityDef reads and checks an entity definition. If it has no name, it is named after the file.
+func LoadEntityDef(filePath string) (*EntityDef, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	def := &EntityDef{Senses: DefSenses, Tolerances: DefTolerances, Recovery: 0.05}
+	if err := json.Unmarshal(data, def); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filePath, err)
+	}
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(path.Base(filePath), ".json")
+	}
+	if def.Mass <= 0 || def.Radius <= 0 {
+		return nil, fmt.Errorf("entity %s in %s must have a positive mass and radius", def.Name, filePath)
+	}
+	if def.Colour != nil && len(def.Colour) != 3 {
+		return nil, fmt.Errorf("entity %s in %s must have a colour with 3 components", def.Name, filePath)
+	}
+	if !hasSpriteAtlas(def.Atlas) {
+		return nil, fmt.Errorf("entity %s in %s uses unknown atlas %q", def.Name, filePath, def.Atlas)
+	}
+	if _, ok := GetSpriteAtlas(def.Atlas).Animations[def.Animation]; def.Animation != "" && !ok {
+		return nil, fmt.Errorf("entity %s in %s uses unknown animation %q", def.Name, filePath, def.Animation)
+	}
+	// Check the arbitration and build the behaviours once now, so mistakes are found when loading rather than when spawning
+	if _, err := GetArbitrationPolicy(def.Arbitration); err != nil {
+		return nil, fmt.Errorf("entity %s in %s: %w", def.Name, filePath, err)
+	}
+	behaviours, err := def.buildBehaviours()
+	if err != nil {
+		return nil, fmt.Errorf("entity %s in %s: %w", def.Name, filePath, err)
+	}
+	if def.Brain != nil {
+		root, err := BuildBehaviourTree(def.Brain)
+		if err != nil {
+			return nil, fmt.Errorf("entity %s in %s: %w", def.Name, filePath, err)
+		}
+		if err := checkBrainUses(root, behaviours); err != nil {
+			return nil, fmt.Errorf("entity %s in %s: %w", def.Name, filePath, err)
+		}
+	}
+	return def, nil
+}
+
+// checkBrainUses makes sure every behaviour the tree uses is one of the creature's behaviours
+func checkBrainUses(n BTNode, behaviours []weightedBehaviour) error {
+	if use, ok := n.(*BTUse); ok {
+		for _, name := range use.Behaviours {
+			if !slices.ContainsFunc(behaviours, func(b weightedBehaviour) bool { return b.Name() == name }) {
+				return fmt.Errorf("brain uses behaviour %q which the entity does not have", name)
+			}
+		}
+	}
+	for _, c := range n.Children() {
+		if err := checkBrainUses(c, behaviours); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterEntityDef makes a definition spawnable by its name
+func RegisterEntityDef(def *EntityDef) error {
+	return RegisterEntityType(def.Name, func(pos pixel.Vec, settings *SimulationSettings, seed int64) (Entity, error) {
+		c, err := NewCreature(def, pos, seed)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+// buildBehaviours creates a new set of behaviours with the parameters from the definition
+func (def *EntityDef) buildBehaviours() ([]weightedBehaviour, error) {
+	behaviours := make([]weightedBehaviour, len(def.Behaviours))
+	for i, raw := range def.Behaviours {
+		var header behaviourHeader
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return nil, err
+		}
+		newBehaviour, ok := behaviourTypes[header.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown behaviour %q", header.Type)
+		}
+		b := newBehaviour()
+		if err := json.Unmarshal(raw, b); err != nil {
+			return nil, fmt.Errorf("failed to decode behaviour %s: %w", header.Type, err)
+		}
+		switch b.(type) {
+		case Steering, Actuator:
+		default:
+			return nil, fmt.Errorf("behaviour %s neither steers nor acts", header.Type)
+		}
+		behaviours[i] = weightedBehaviour{b, 1}
+		if header.Weight != nil {
+			behaviours[i].weight = *header.Weight
+		}
+	}
+	return behaviours, nil
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"image/color"
-	"math/rand"
 
 	"github.com/gopxl/pixel"
 	"github.com/gopxl/pixel/imdraw"
@@ -15,12 +14,13 @@ type DummyEntity struct {
 	col color.Color
 }
 
-// NewDummyEntity creates a new dummy entity with position and radius
-func NewDummyEntity(pos pixel.Vec, radius float64) *DummyEntity {
+// NewDummyEntity creates a new dummy entity with position and radius, and a random colour from seed
+func NewDummyEntity(pos pixel.Vec, radius float64, seed int64) *DummyEntity {
+	rng := NewRNG(seed)
 	return &DummyEntity{
 		*NewEntityBase(pos, 1, radius),
 		imdraw.New(nil),
-		pixel.RGB(rand.Float64(), rand.Float64(), rand.Float64()),
+		pixel.RGB(rng.Float64(), rng.Float64(), rng.Float64()),
 	}
 }
 
@@ -34,8 +34,14 @@ func (e *DummyEntity) Render(rd *RenderData) {
 }
 
 // StepLogic adds forces and stuff to be integrated later, in this case adds gravity
-func (e *DummyEntity) StepLogic() {
+func (e *DummyEntity) StepLogic(w *World) {
 	e.ApplyForce(pixel.V(0, -9.81*e.Mass()))
 }
 
 func (e *DummyEntity) Tags() []string { return []string{} }
+
+func (e *DummyEntity) Clone() Entity {
+	clone := *e
+	clone.imd = imdraw.New(nil)
+	return &clone
+}
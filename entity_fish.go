@@ -1,56 +1,86 @@
 package main
 
 import (
+	"fmt"
 	"image/color"
 	"math"
-	"math/rand"
-	"time"
 
 	"github.com/gopxl/pixel"
 )
 
+// Fish with an evolved brain see the map through a fan of rays in front of them
+const (
+	fishBrainRays   = 5
+	fishBrainSpread = math.Pi // Angle covered by the fan of rays
+	// FishBrainInputs is the number of inputs a fish brain takes: the rays, the offset and velocity of neighbours,
+	// the light, the fish's energy, and the directions of the nearest predator and food
+	FishBrainInputs = fishBrainRays + 2 + 2 + 1 + 1 + 2 + 2
+	// FishBrainOutputs is the number of outputs a fish brain gives: thrust and turn rate
+	FishBrainOutputs = 2
+)
+
+// fishRestingEnergy is the fraction of the full thrust energy use that a fish uses while not swimming at all
+const fishRestingEnergy = 0.25
+
 type FishEntity struct {
 	EntityBase
 	anim        *Animator
 	angle       float64
 	nextDir     pixel.Vec
-	lastDirTime time.Time
+	lastDirTime float64
 	col         color.Color
+	settings    *FishSettings
+	cover       float64
+	energy      float64
+	conditions  Conditions // Conditions of the water the fish was last in
+	brain       *NeuralNet // Optional evolved brain, which replaces wandering
+	brainBuf    []float64
+	inputs      []float64
+	perception  Perception
+	thrust      float64 // Fraction of full thrust used on the last step
+	turn        float64 // Turn rate chosen by the brain on the last step, in radians per second
+	rng         RNG
+	now         float64
 }
 
-func NewFish(pos pixel.Vec) *FishEntity {
-	pic := GetSpritePicture("entities")
-	anim := NewAnimator(pic, 32,
-		map[string]pixel.Vec{
-			"swimleft.1":  pixel.V(0+6, 2),
-			"swimleft.2":  pixel.V(1+6, 2),
-			"swimleft.3":  pixel.V(2+6, 2),
-			"swimright.1": pixel.V(0+6, 1),
-			"swimright.2": pixel.V(1+6, 1),
-			"swimright.3": pixel.V(2+6, 1),
-		},
-		map[string][]string{
-			"swimleft":  {"swimleft.1", "swimleft.2", "swimleft.3", "swimleft.2"},
-			"swimright": {"swimright.1", "swimright.2", "swimright.3", "swimright.2"},
-		},
-		map[string]float64{
-			"swimleft":  0.5,
-			"swimright": 0.5,
-		},
-	)
+// NewFish creates a new fish at the position, with all of its randomness coming from seed.
+// The settings are shared, so changing them will affect the fish while it is alive.
+func NewFish(pos pixel.Vec, settings *FishSettings, seed int64) *FishEntity {
+	anim := NewAtlasAnimator("entities")
 	anim.Play("swimleft")
+	rng := NewRNG(seed)
 	return &FishEntity{
-		*NewEntityBase(pos, 1, 0.5),
-		anim,
-		0,
-		pixel.Unit(rand.Float64() * rand.Float64() * 3.14 * 2),
-		time.Now(),
-		pixel.RGB(rand.Float64(), rand.Float64(), rand.Float64()),
+		EntityBase:  *NewEntityBase(pos, 1, 0.5),
+		anim:        anim,
+		nextDir:     pixel.Unit(rng.Float64() * rng.Float64() * 3.14 * 2),
+		lastDirTime: -1, // The wander timer starts on the first step
+		col:         pixel.RGB(rng.Float64(), rng.Float64(), rng.Float64()),
+		settings:    settings,
+		energy:      1,
+		rng:         rng,
 	}
 }
 
+// NewNeuralFish creates a fish that is steered by a brain rather than wandering. The brain must take
+// FishBrainInputs inputs and give FishBrainOutputs outputs, and may be shared with other fish.
+func NewNeuralFish(pos pixel.Vec, settings *FishSettings, brain *NeuralNet, seed int64) (*FishEntity, error) {
+	if brain.Inputs() != FishBrainInputs || brain.Outputs() != FishBrainOutputs {
+		return nil, fmt.Errorf("fish brain must have %d inputs and %d outputs, has %d and %d",
+			FishBrainInputs, FishBrainOutputs, brain.Inputs(), brain.Outputs())
+	}
+	e := NewFish(pos, settings, seed)
+	e.angle = e.nextDir.Angle()
+	e.brain = brain
+	e.brainBuf = make([]float64, brain.BufferSize())
+	e.inputs = make([]float64, FishBrainInputs)
+	return e, nil
+}
+
 func (e *FishEntity) Render(rd *RenderData) {
 	s := e.anim.CurrentSprite()
+	if s == nil {
+		return
+	}
 	tmat := pixel.IM.Scaled(pixel.ZV, e.Radius()*2/s.Frame().W())
 	rotAngle := e.angle
 	if math.Cos(e.angle) < 0 {
@@ -63,25 +93,152 @@ func (e *FishEntity) Render(rd *RenderData) {
 	s.DrawColorMask(rd.Target, tmat, e.col)
 }
 
-func (e *FishEntity) StepLogic() {
-	if time.Since(e.lastDirTime).Seconds() > 5 {
-		e.lastDirTime = time.Now()
-		e.nextDir = pixel.Unit(rand.Float64() * 3.14 * 2)
+func (e *FishEntity) StepLogic(w *World) {
+	e.now = w.Time()
+	e.cover = CoverAt(w, e.Position(), e.Radius()*3)
+	if e.brain != nil {
+		e.think(w)
+	} else {
+		e.wander()
+	}
+	if math.Cos(e.angle) < 0 {
+		e.anim.SwitchTo("swimleft")
+	} else {
+		e.anim.SwitchTo("swimright")
+	}
+	// Swim faster when moving faster, but never stop completely
+	e.anim.SetSpeed(e.settings.SwimAnimationSpeed * math.Max(e.Velocity().Len(), 0.5))
+	e.anim.Step(1.0 / 60)
+	// Keep the last conditions if pushed into a solid texel for a moment, rather than having none
+	if c, ok := w.Map.ConditionsAt(e.Position()); ok {
+		e.conditions = c
+	}
+	use := e.settings.EnergyUse*(fishRestingEnergy+(1-fishRestingEnergy)*e.thrust) + e.settings.Tolerances.Drain(e.conditions)
+	e.energy = math.Max(e.energy-use*FixedPhysicsTimestep, 0)
+	// Fish can only swim in the water, and fall back in if they leap out
+	if w.InWater(e.Position()) {
+		e.ApplyForce(pixel.V(e.settings.Thrust*e.thrust, 0).Rotated(e.angle))
+		e.ApplyForce(DragForce(e.Velocity().Sub(w.FlowAt(e.Position())), e.settings.Drag))
+	}
+}
+
+// wander turns towards a new random direction every so often, slowing down to hide when in cover
+func (e *FishEntity) wander() {
+	if e.lastDirTime < 0 {
+		e.lastDirTime = e.now
+	}
+	if e.now-e.lastDirTime > e.settings.DirChangeInterval {
+		e.lastDirTime = e.now
+		e.nextDir = pixel.Unit(e.rng.Float64() * 3.14 * 2)
 	}
-	maxRot := math.Pi * 2 / 60.0
+	maxRot := e.settings.TurnSpeed / 60.0
 	if SignedAngleBetween(e.nextDir, pixel.Unit(e.angle)) > 0 {
 		e.angle += maxRot
 	} else {
 		e.angle -= maxRot
 	}
-	if math.Cos(e.angle) < 0 {
-		e.anim.PlayIfNot("swimleft")
+	e.thrust = 1 - e.cover*e.settings.CoverSlowdown
+}
+
+// think senses the surroundings and lets the brain choose how hard to swim and how fast to turn.
+// Directions are given relative to the way the fish is facing, so the brain does not need to know its heading.
+// Fish only sense when they have a brain, as wandering does not use what they perceive.
+func (e *FishEntity) think(w *World) {
+	e.settings.Senses.Sense(e, e.angle, w, &e.perception)
+	// The brain always sees the same fan of rays, whatever the senses cast, but it sees less far in the dark
+	sight := math.Max(e.perception.VisionRange, 1e-3)
+	in := e.inputs[:0]
+	for i := 0; i < fishBrainRays; i++ {
+		angle := e.angle - fishBrainSpread/2 + fishBrainSpread*float64(i)/(fishBrainRays-1)
+		_, dist := w.Map.Raycast(e.Position(), pixel.Unit(angle), sight)
+		in = append(in, 1-dist/sight)
+	}
+	offset, vel := e.neighbours()
+	offset, vel = offset.Rotated(-e.angle), vel.Rotated(-e.angle)
+	in = append(in, offset.X, offset.Y, vel.X, vel.Y)
+	in = append(in, w.Map.GetLightAt(e.Position()), e.energy)
+	maxRange := math.Max(e.settings.Senses.VisionRange, e.settings.Senses.LateralRange)
+	for _, tag := range []string{"predator", "food"} {
+		dir := pixel.ZV
+		if p, ok := e.perception.Nearest(tag, math.Inf(1)); ok {
+			// Closer things give a stronger signal
+			dir = p.Offset.Unit().Rotated(-e.angle).Scaled(1 - p.Distance/maxRange)
+		}
+		in = append(in, dir.X, dir.Y)
+	}
+	out := e.brain.Forward(in, e.brainBuf)
+	e.thrust = (out[0] + 1) / 2
+	e.turn = out[1] * e.settings.TurnSpeed
+	e.angle = math.Remainder(e.angle+e.turn*FixedPhysicsTimestep, 2*math.Pi)
+}
+
+// neighbours returns the offset to the centre of the perceived fish within the neighbour radius, as a fraction of
+// the radius, and their average velocity, kept no longer than 1
+func (e *FishEntity) neighbours() (pixel.Vec, pixel.Vec) {
+	radius := e.settings.NeighbourRadius
+	offset, vel := pixel.ZV, pixel.ZV
+	count := 0
+	e.perception.WithTag("fish", radius, func(p Percept) {
+		offset, vel = offset.Add(p.Offset), vel.Add(p.Entity.Velocity())
+		count++
+	})
+	if count == 0 {
+		return pixel.ZV, pixel.ZV
+	}
+	return offset.Scaled(1 / (float64(count) * radius)), clampLen(vel.Scaled(1/(float64(count)*e.settings.Thrust)), 1)
+}
+
+// Feed gives the fish energy, up to a full store of 1
+func (e *FishEntity) Feed(energy float64) {
+	e.energy = math.Min(e.energy+energy, 1)
+}
+
+// Energy returns how much energy the fish has left, between 0 and 1
+func (e *FishEntity) Energy() float64 {
+	return e.energy
+}
+
+func (e *FishEntity) Clone() Entity {
+	clone := *e
+	clone.anim = e.anim.Clone()
+	if e.brain != nil {
+		clone.brainBuf = make([]float64, len(e.brainBuf))
+		clone.inputs = make([]float64, len(e.inputs))
+	}
+	clone.perception.Clear()
+	return &clone
+}
+
+// Perception returns what the fish perceived on its last step. Only fish with a brain sense their surroundings.
+func (e *FishEntity) Perception() *Perception {
+	return &e.perception
+}
+
+// Cover returns how hidden the fish was by plants during its last logic step, between 0 and 1
+func (e *FishEntity) Cover() float64 {
+	return e.cover
+}
+
+func (e *FishEntity) DebugFields() []DebugField {
+	fields := []DebugField{
+		{"animation", fmt.Sprintf("%s (%.2f)", e.anim.Current(), e.anim.NormalisedTime())},
+		{"heading", fmt.Sprintf("%.1f deg", e.angle*180/math.Pi)},
+	}
+	if e.brain != nil {
+		fields = append(fields,
+			DebugField{"thrust", fmt.Sprintf("%.2f", e.thrust)},
+			DebugField{"turn", fmt.Sprintf("%.1f deg/s", e.turn*180/math.Pi)},
+		)
+		fields = append(fields, e.perception.DebugFields()...)
 	} else {
-		e.anim.PlayIfNot("swimright")
+		fields = append(fields,
+			DebugField{"wander dir", fmt.Sprintf("%.1f deg", e.nextDir.Angle()*180/math.Pi)},
+			DebugField{"next wander", fmt.Sprintf("%.1fs", e.settings.DirChangeInterval-(e.now-e.lastDirTime))},
+		)
 	}
-	e.anim.Step(1.0 / 60)
-	// Move towards target
-	e.ApplyForce(pixel.V(5, 0).Rotated(e.angle))
-	// Drag
-	e.ApplyForce(DragForce(e.Velocity(), 1))
+	return append(fields,
+		DebugField{"cover", fmt.Sprintf("%.2f", e.cover)},
+		DebugField{"energy", fmt.Sprintf("%.2f", e.energy)},
+		DebugField{"conditions", e.conditions.String()},
+	)
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/imdraw"
+	"golang.org/x/image/colornames"
+)
+
+// foodScentRate is how much food scent a pellet gives off per second
+const foodScentRate = 1
+
+// FoodEntity is a pellet of food floating in place, for fish to find and eat. It gives off a scent that spreads
+// through the water, so it can be found by smell.
+type FoodEntity struct {
+	EntityBase
+	scentBuffer
+	imd *imdraw.IMDraw
+}
+
+// NewFood creates a food pellet at the position
+func NewFood(pos pixel.Vec) *FoodEntity {
+	return &FoodEntity{EntityBase: *NewEntityBase(pos, 1, 0.25), imd: imdraw.New(nil)}
+}
+
+func (e *FoodEntity) Render(rd *RenderData) {
+	e.imd.Clear()
+	e.imd.Color = colornames.Yellowgreen
+	e.imd.Push(e.Position().Sub(rd.CameraWorldPos).Scaled(rd.PixelsPerMeter).Add(rd.TargetRect.Center()))
+	e.imd.Circle(e.radius*rd.PixelsPerMeter, 0)
+	e.imd.Draw(rd.Target)
+}
+
+func (e *FoodEntity) StepLogic(w *World) {
+	e.deposit(ScentDeposit{ScentFood, e.Position(), foodScentRate * FixedPhysicsTimestep})
+}
+
+// Food stays where it is put, and is not pushed around by fish swimming into it
+func (e *FoodEntity) IsKinematic() bool { return true }
+
+func (e *FoodEntity) Tags() []string { return []string{"food"} }
+
+func (e *FoodEntity) Clone() Entity {
+	clone := *e
+	clone.imd = imdraw.New(nil)
+	clone.scentBuffer = scentBuffer{}
+	return &clone
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/imdraw"
+)
+
+// KelpSegment is one link in a strand of kelp. The base of a strand is kinematic so it stays anchored,
+// and the rest float upwards and sway in the current.
+type KelpSegment struct {
+	EntityBase
+	imd      *imdraw.IMDraw
+	col      color.Color
+	anchored bool
+	buoyancy float64
+	drag     float64
+	next     *KelpSegment
+}
+
+// NewKelpSegment creates a single segment of kelp. Anchored segments never move.
+func NewKelpSegment(pos pixel.Vec, radius float64, anchored bool, settings FloraSettings) *KelpSegment {
+	return &KelpSegment{
+		EntityBase: *NewEntityBase(pos, settings.SegmentMass, radius),
+		imd:        imdraw.New(nil),
+		col:        pixel.RGB(0.2, 0.5, 0.15),
+		anchored:   anchored,
+		buoyancy:   settings.Buoyancy,
+		drag:       settings.Drag,
+	}
+}
+
+// Render draws the segment as a blob, with a stalk joining it to the next segment up the strand
+func (e *KelpSegment) Render(rd *RenderData) {
+	toScreen := func(v pixel.Vec) pixel.Vec {
+		return v.Sub(rd.CameraWorldPos).Scaled(rd.PixelsPerMeter).Add(rd.TargetRect.Center())
+	}
+	e.imd.Clear()
+	e.imd.Color = e.col
+	if e.next != nil {
+		e.imd.Push(toScreen(e.Position()), toScreen(e.next.Position()))
+		e.imd.Line(e.radius * rd.PixelsPerMeter)
+	}
+	e.imd.Push(toScreen(e.Position()))
+	e.imd.Circle(e.radius*rd.PixelsPerMeter, 0)
+	e.imd.Draw(rd.Target)
+}
+
+// StepLogic floats the segment upwards and drags it along with the current
+func (e *KelpSegment) StepLogic(w *World) {
+	if e.anchored {
+		return
+	}
+	if w.InWater(e.Position()) {
+		e.ApplyForce(pixel.V(0, e.buoyancy))
+	}
+	e.ApplyForce(StableDragForce(e.Velocity().Sub(w.CurrentAt(e.Position())), e.drag, e.Mass()))
+}
+
+func (e *KelpSegment) IsKinematic() bool { return e.anchored }
+
+func (e *KelpSegment) Tags() []string { return []string{"kelp"} }
+
+func (e *KelpSegment) Clone() Entity {
+	clone := *e
+	clone.imd = imdraw.New(nil)
+	return &clone
+}
+
+func (e *KelpSegment) RemapEntities(remap func(Entity) Entity) {
+	if e.next != nil {
+		e.next = remap(e.next).(*KelpSegment)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gopxl/pixel"
+)
+
+// PredatorEntity is a large fish that hunts the nearest fish it can see. When there are none it follows the scent
+// of blood if it can smell any, and otherwise wanders.
+type PredatorEntity struct {
+	EntityBase
+	stimulusBuffer
+	anim        *Animator
+	angle       float64
+	nextDir     pixel.Vec
+	lastDirTime float64
+	settings    *PredatorSettings
+	target      Entity
+	perception  Perception
+	rng         RNG
+	now         float64
+}
+
+// NewPredator creates a new predator at the position, with all of its randomness coming from seed.
+// The settings are shared, so changing them will affect the predator while it is alive.
+func NewPredator(pos pixel.Vec, settings *PredatorSettings, seed int64) *PredatorEntity {
+	anim := NewAtlasAnimator("entities")
+	anim.Play("swimleft")
+	rng := NewRNG(seed)
+	return &PredatorEntity{
+		EntityBase:  *NewEntityBase(pos, 4, 1.2),
+		anim:        anim,
+		nextDir:     pixel.Unit(rng.Float64() * 3.14 * 2),
+		lastDirTime: -1,
+		settings:    settings,
+		rng:         rng,
+	}
+}
+
+func (e *PredatorEntity) Render(rd *RenderData) {
+	s := e.anim.CurrentSprite()
+	if s == nil {
+		return
+	}
+	tmat := pixel.IM.Scaled(pixel.ZV, e.Radius()*2/s.Frame().W())
+	rotAngle := e.angle
+	if math.Cos(e.angle) < 0 {
+		rotAngle += math.Pi
+	}
+	tmat = tmat.Rotated(pixel.ZV, rotAngle)
+	tmat = tmat.Moved(e.Position().Sub(rd.CameraWorldPos))
+	tmat = tmat.Scaled(pixel.ZV, rd.PixelsPerMeter)
+	tmat = tmat.Moved(rd.TargetRect.Bounds().Center())
+	s.DrawColorMask(rd.Target, tmat, pixel.RGB(0.6, 0.15, 0.15))
+}
+
+func (e *PredatorEntity) StepLogic(w *World) {
+	e.now = w.Time()
+	if e.lastDirTime < 0 {
+		e.lastDirTime = e.now
+	}
+	// Chase the nearest fish it can perceive, or follow blood, or wander. Starting a chase makes a splash.
+	e.settings.Senses.Sense(e, e.angle, w, &e.perception)
+	hadTarget := e.target != nil
+	e.target = e.nearestPrey(w)
+	if e.target != nil && !hadTarget {
+		e.emit(Stimulus{StimulusSplash, e.Position(), e.settings.SplashIntensity, e})
+	}
+	if e.target != nil {
+		e.nextDir = e.target.Position().Sub(e.Position()).Unit()
+	} else if blood := w.Scent.Gradient(ScentBlood, e.Position()); blood != pixel.ZV &&
+		w.Scent.At(ScentBlood, e.Position()) > e.settings.BloodScent {
+		e.lastDirTime = e.now
+		e.nextDir = blood.Unit()
+	} else if e.now-e.lastDirTime > e.settings.DirChangeInterval {
+		e.lastDirTime = e.now
+		e.nextDir = pixel.Unit(e.rng.Float64() * 3.14 * 2)
+	}
+	maxRot := e.settings.TurnSpeed / 60.0
+	if SignedAngleBetween(e.nextDir, pixel.Unit(e.angle)) > 0 {
+		e.angle += maxRot
+	} else {
+		e.angle -= maxRot
+	}
+	if math.Cos(e.angle) < 0 {
+		e.anim.SwitchTo("swimleft")
+	} else {
+		e.anim.SwitchTo("swimright")
+	}
+	e.anim.SetSpeed(0.25 * math.Max(e.Velocity().Len(), 0.5))
+	e.anim.Step(1.0 / 60)
+	if w.InWater(e.Position()) {
+		e.ApplyForce(pixel.V(e.settings.Thrust, 0).Rotated(e.angle))
+		e.ApplyForce(DragForce(e.Velocity().Sub(w.FlowAt(e.Position())), e.settings.Drag))
+	}
+}
+
+// nearestPrey finds the closest fish the predator perceives, ignoring any that are hidden in plants.
+// Other entities are stepping at the same time, so this only reads positions, which do not change during logic.
+func (e *PredatorEntity) nearestPrey(w *World) Entity {
+	var nearest Entity
+	nearestDist := math.Inf(1)
+	e.perception.WithTag("fish", nearestDist, func(p Percept) {
+		if p.Distance < nearestDist && CoverAt(w, p.Entity.Position(), p.Entity.Radius()*3) < 1 {
+			nearest, nearestDist = p.Entity, p.Distance
+		}
+	})
+	return nearest
+}
+
+func (e *PredatorEntity) Perception() *Perception { return &e.perception }
+
+func (e *PredatorEntity) Tags() []string { return []string{"predator"} }
+
+func (e *PredatorEntity) Clone() Entity {
+	clone := *e
+	clone.anim = e.anim.Clone()
+	clone.perception.Clear()
+	clone.stimulusBuffer = stimulusBuffer{}
+	return &clone
+}
+
+func (e *PredatorEntity) RemapEntities(remap func(Entity) Entity) {
+	if e.target != nil {
+		e.target = remap(e.target)
+	}
+}
+
+func (e *PredatorEntity) DebugFields() []DebugField {
+	target := "none"
+	if e.target != nil {
+		target = fmt.Sprintf("%.1fm away", e.target.Position().Sub(e.Position()).Len())
+	}
+	return append([]DebugField{
+		{"heading", fmt.Sprintf("%.1f deg", e.angle*180/math.Pi)},
+		{"target", target},
+	}, e.perception.DebugFields()...)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gopxl/pixel"
+)
+
+// EntitySpawnFunc creates a new entity of a type at a position, using the world's settings.
+// Any randomness in the entity should come from seed, so the same seed always creates the same entity.
+type EntitySpawnFunc func(pos pixel.Vec, settings *SimulationSettings, seed int64) (Entity, error)
+
+// entityTypes are all of the entities that can be spawned by name
+var entityTypes = map[string]EntitySpawnFunc{
+	"fish": func(pos pixel.Vec, settings *SimulationSettings, seed int64) (Entity, error) {
+		return NewFish(pos, &settings.FishSettings, seed), nil
+	},
+	"predator": func(pos pixel.Vec, settings *SimulationSettings, seed int64) (Entity, error) {
+		return NewPredator(pos, &settings.PredatorSettings, seed), nil
+	},
+	"food": func(pos pixel.Vec, settings *SimulationSettings, seed int64) (Entity, error) {
+		return NewFood(pos), nil
+	},
+	"dummy": func(pos pixel.Vec, settings *SimulationSettings, seed int64) (Entity, error) {
+		return NewDummyEntity(pos, 0.5, seed), nil
+	},
+}
+
+// RegisterEntityType adds a new type of entity that can be spawned by name. Names must be unique.
+func RegisterEntityType(name string, spawn EntitySpawnFunc) error {
+	if _, ok := entityTypes[name]; ok {
+		return fmt.Errorf("entity type %q already exists", name)
+	}
+	entityTypes[name] = spawn
+	return nil
+}
+
+// SpawnEntity creates a new entity of the named type
+func SpawnEntity(name string, pos pixel.Vec, settings *SimulationSettings, seed int64) (Entity, error) {
+	spawn, ok := entityTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown entity type %q", name)
+	}
+	return spawn(pos, settings, seed)
+}
+
+// EntityTypeNames returns the names of all entity types in alphabetical order
+func EntityTypeNames() []string {
+	names := make([]string, 0, len(entityTypes))
+	for name := range entityTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/aquilax/go-perlin"
+	"github.com/gopxl/pixel"
+)
+
+// EnvironmentParams control how the temperature, salinity and oxygen of the water are generated with the map
+type EnvironmentParams struct {
+	SurfaceTemperature float64 `json:"surface-temperature"` // Degrees celsius at the surface
+	DeepTemperature    float64 `json:"deep-temperature"`    // Degrees celsius at the bottom of the map
+	Thermocline        float64 `json:"thermocline"`         // Depth, as a fraction of the map, over which most of the warmth is lost
+	Vents              int     `json:"vents"`               // Number of hydrothermal vents on the sea floor
+	VentTemperature    float64 `json:"vent-temperature"`    // Degrees celsius a vent adds to the water around it
+	VentRadius         float64 `json:"vent-radius"`         // Distance over which a vent warms the water
+	SurfaceSalinity    float64 `json:"surface-salinity"`    // Parts per thousand at the surface
+	DeepSalinity       float64 `json:"deep-salinity"`       // Parts per thousand at the bottom of the map
+	SalinityNoise      float64 `json:"salinity-noise"`      // Largest random change in salinity from place to place
+	SurfaceOxygen      float64 `json:"surface-oxygen"`      // Milligrams per litre where the water meets the air
+	DeepOxygen         float64 `json:"deep-oxygen"`         // Milligrams per litre in water cut off from the surface
+	OxygenFalloff      float64 `json:"oxygen-falloff"`      // Distance through the water from the surface over which most oxygen is used up
+}
+
+// validate checks that the conditions can be generated with the parameters, as the distances are divided by
+func (p *EnvironmentParams) validate() error {
+	if p.Thermocline <= 0 || p.VentRadius <= 0 || p.OxygenFalloff <= 0 {
+		return errors.New("environment thermocline, vent-radius and oxygen-falloff must be positive")
+	}
+	return nil
+}
+
+// Conditions are the temperature, salinity and dissolved oxygen of the water at one place
+type Conditions struct {
+	Temperature float64
+	Salinity    float64
+	Oxygen      float64
+}
+
+func (c Conditions) String() string {
+	return fmt.Sprintf("%.1fC, %.1fppt, %.1fmg/l O2", c.Temperature, c.Salinity, c.Oxygen)
+}
+
+// envChunkSize is the width and height in texels of each chunk of the environment
+const envChunkSize = 16
+
+// envChunk holds the conditions of a square of texels, indexed by x*envChunkSize+y
+type envChunk [envChunkSize * envChunkSize]Conditions
+
+// Environment holds the conditions of every water texel of a map. It is stored in chunks, and chunks that are
+// entirely solid are not stored at all, as nothing can ever be in them. It does not change once generated.
+type Environment struct {
+	chunksWide, chunksHigh int
+	chunks                 []*envChunk // Indexed by cx*chunksHigh+cy
+}
+
+// at returns the conditions of a texel, which must be water
+func (e *Environment) at(tx, ty int) Conditions {
+	return e.chunks[(tx/envChunkSize)*e.chunksHigh+ty/envChunkSize][(tx%envChunkSize)*envChunkSize+ty%envChunkSize]
+}
+
+// generateEnvironment works out the conditions of every water texel of a map. Temperature and salinity change
+// with depth, with vents warming the water near them and noise varying the salinity. Oxygen dissolves in at the
+// surface and is used up with distance through the water from it, so deep caves are starved of it.
+func generateEnvironment(m *Map, params EnvironmentParams, seed int64) *Environment {
+	width, height := len(m.texels), len(m.texels[0])
+	env := &Environment{
+		chunksWide: (width + envChunkSize - 1) / envChunkSize,
+		chunksHigh: (height + envChunkSize - 1) / envChunkSize,
+	}
+	env.chunks = make([]*envChunk, env.chunksWide*env.chunksHigh)
+
+	vents := ventPositions(m, params.Vents, seed)
+	surfaceDist := distancesFromSurface(m)
+	noise := perlin.NewPerlin(2, 2, 3, seed+1)
+	for tx := 0; tx < width; tx++ {
+		for ty := 0; ty < height; ty++ {
+			if !m.IsWater(tx, ty) {
+				continue
+			}
+			pos := pixel.V(float64(tx), float64(ty))
+			depth := m.GetDepthAt(pos)
+			warmth := math.Exp(-depth / params.Thermocline)
+			c := Conditions{
+				Temperature: params.DeepTemperature + (params.SurfaceTemperature-params.DeepTemperature)*warmth,
+				Salinity: params.SurfaceSalinity + (params.DeepSalinity-params.SurfaceSalinity)*depth +
+					noise.Noise2D(pos.X/64, pos.Y/64)*params.SalinityNoise,
+				Oxygen: params.DeepOxygen,
+			}
+			for _, v := range vents {
+				d := pos.Sub(v).Len() / params.VentRadius
+				c.Temperature += params.VentTemperature * math.Exp(-d*d)
+			}
+			if dist := surfaceDist[tx*height+ty]; dist >= 0 {
+				c.Oxygen += (params.SurfaceOxygen - params.DeepOxygen) * math.Exp(-float64(dist)/params.OxygenFalloff)
+			}
+
+			cx, cy := tx/envChunkSize, ty/envChunkSize
+			ci := cx*env.chunksHigh + cy
+			if env.chunks[ci] == nil {
+				env.chunks[ci] = new(envChunk)
+			}
+			env.chunks[ci][(tx%envChunkSize)*envChunkSize+ty%envChunkSize] = c
+		}
+	}
+	return env
+}
+
+// ventPositions places vents at random on the sea floor, in the water just above solid texels
+func ventPositions(m *Map, count int, seed int64) []pixel.Vec {
+	width, height := len(m.texels), len(m.texels[0])
+	rng := NewRNG(seed)
+	var vents []pixel.Vec
+	for attempt := 0; len(vents) < count && attempt < count*10; attempt++ {
+		tx := 1 + rng.Intn(width-2)
+		// Sink from the surface until the floor is reached
+		ty := height - 2
+		for ty > 0 && !m.IsSolid(tx, ty-1) {
+			ty--
+		}
+		if ty > 0 && m.IsWater(tx, ty) {
+			vents = append(vents, pixel.V(float64(tx), float64(ty)))
+		}
+	}
+	return vents
+}
+
+// distancesFromSurface finds how far each texel is from the surface travelling only through water, indexed by
+// tx*height+ty. Texels that can not be reached, including ones that are not water, are -1.
+func distancesFromSurface(m *Map) []int {
+	width, height := len(m.texels), len(m.texels[0])
+	dist := make([]int, width*height)
+	for i := range dist {
+		dist[i] = -1
+	}
+	var queue [][2]int
+	// The surface is every water texel with air above it
+	for tx := 0; tx < width; tx++ {
+		for ty := 0; ty < height-1; ty++ {
+			if m.IsWater(tx, ty) && m.texels[tx][ty+1] == AirTexel {
+				dist[tx*height+ty] = 0
+				queue = append(queue, [2]int{tx, ty})
+			}
+		}
+	}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		d := dist[t[0]*height+t[1]]
+		for _, n := range [4][2]int{{t[0] - 1, t[1]}, {t[0] + 1, t[1]}, {t[0], t[1] - 1}, {t[0], t[1] + 1}} {
+			if !m.IsWater(n[0], n[1]) || dist[n[0]*height+n[1]] >= 0 {
+				continue
+			}
+			dist[n[0]*height+n[1]] = d + 1
+			queue = append(queue, n)
+		}
+	}
+	return dist
+}
+
+// ConditionsAt returns the conditions of the water at a point, and whether there is water there to have any
+func (m *Map) ConditionsAt(pos pixel.Vec) (Conditions, bool) {
+	tx, ty := int(math.Round(pos.X)), int(math.Round(pos.Y))
+	if !m.IsWater(tx, ty) {
+		return Conditions{}, false
+	}
+	return m.environment.at(tx, ty), true
+}
+
+// Tolerance is the range of a condition that a species is comfortable in
+type Tolerance struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// outside returns how far a value is outside the range, or 0 if it is within it
+func (t Tolerance) outside(v float64) float64 {
+	return math.Max(math.Max(t.Min-v, v-t.Max), 0)
+}
+
+// Tolerances are the conditions a species can live in comfortably. Outside of them it uses extra energy,
+// more the further outside it is.
+type Tolerances struct {
+	Temperature Tolerance `json:"temperature"` // Degrees celsius
+	Salinity    Tolerance `json:"salinity"`    // Parts per thousand
+	Oxygen      Tolerance `json:"oxygen"`      // Milligrams per litre
+	Stress      float64   `json:"stress"`      // Extra energy used per second for each unit outside a range
+}
+
+var DefTolerances = Tolerances{
+	Temperature: Tolerance{Min: 5, Max: 28},
+	Salinity:    Tolerance{Min: 30, Max: 38},
+	Oxygen:      Tolerance{Min: 3, Max: 100},
+	Stress:      0.01,
+}
+
+// Strain returns how far the conditions are outside the tolerances, adding up every condition
+func (t *Tolerances) Strain(c Conditions) float64 {
+	return t.Temperature.outside(c.Temperature) + t.Salinity.outside(c.Salinity) + t.Oxygen.outside(c.Oxygen)
+}
+
+// Drain returns the extra energy used per second because of the conditions
+func (t *Tolerances) Drain(c Conditions) float64 {
+	return t.Strain(c) * t.Stress
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gopxl/pixel"
+)
+
+// DefEvolutionPath is where the evolution config is loaded from if none is given
+const DefEvolutionPath = "data/evolution.json"
+
+// evolveFeedingIntensity is how loud a fish is when it eats, so others may learn to find food by listening
+const evolveFeedingIntensity = 2
+
+// evolveBloodAmount is how much blood is spilled when a fish is caught, for predators to track down more
+const evolveBloodAmount = 5
+
+// EvolutionConfig controls how fish brains are evolved
+type EvolutionConfig struct {
+	// Scenario is the world every generation is tested in, such as predators and food. The evolving fish are added to it.
+	Scenario         Scenario       `json:"scenario"`
+	Seeds            []int64        `json:"seeds"` // Map seeds to test on. Each genome's fitness is averaged over all of them.
+	Population       int            `json:"population"`
+	Generations      int            `json:"generations"`
+	Ticks            int            `json:"ticks"`  // Longest each generation is simulated for, if any fish live that long
+	Hidden           []int          `json:"hidden"` // Sizes of the hidden layers of the brains
+	Elites           int            `json:"elites"` // Number of the best genomes carried over unchanged to the next generation
+	TournamentSize   int            `json:"tournament-size"`
+	MutationRate     float64        `json:"mutation-rate"`     // Chance of each weight being mutated
+	MutationStrength float64        `json:"mutation-strength"` // Standard deviation of mutations
+	SpawnMin         [2]float64     `json:"spawn-min"`
+	SpawnMax         [2]float64     `json:"spawn-max"`
+	FoodEnergy       float64        `json:"food-energy"` // Energy given to a fish for each piece of food it eats
+	Fitness          FitnessWeights `json:"fitness"`
+	Seed             int64          `json:"seed"` // Seed for the random numbers of the evolution itself
+}
+
+// FitnessWeights is how much each achievement counts towards a fish's fitness
+type FitnessWeights struct {
+	Survival float64 `json:"survival"` // Per second alive
+	Food     float64 `json:"food"`     // Per piece of food eaten
+}
+
+var DefEvolutionConfig = EvolutionConfig{
+	Seeds:            []int64{1},
+	Population:       50,
+	Generations:      100,
+	Ticks:            60 * 60,
+	Hidden:           []int{8},
+	Elites:           2,
+	TournamentSize:   3,
+	MutationRate:     0.1,
+	MutationStrength: 0.3,
+	SpawnMin:         [2]float64{2, 200},
+	SpawnMax:         [2]float64{510, 250},
+	FoodEnergy:       0.3,
+	Fitness:          FitnessWeights{Survival: 1, Food: 10},
+	Seed:             1,
+}
+
+// LoadEvolutionConfig reads an evolution config. Any values missing from the file are left as the defaults.
+func LoadEvolutionConfig(path string) (*EvolutionConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := DefEvolutionConfig
+	config.Seeds, config.Hidden = nil, nil
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	if config.Seeds == nil {
+		config.Seeds = DefEvolutionConfig.Seeds
+	}
+	if config.Hidden == nil {
+		config.Hidden = DefEvolutionConfig.Hidden
+	}
+	if config.Population < 2 || config.Elites < 0 || config.Elites > config.Population || config.TournamentSize < 1 {
+		return nil, fmt.Errorf("%s needs a population of at least 2, at most that many elites, and a tournament size of at least 1", path)
+	}
+	for _, size := range config.Hidden {
+		if size <= 0 {
+			return nil, fmt.Errorf("%s has a hidden layer of size %d, but every layer needs at least one neuron", path, size)
+		}
+	}
+	if len(config.Seeds) == 0 || config.Ticks <= 0 {
+		return nil, fmt.Errorf("%s needs at least one seed and a positive number of ticks", path)
+	}
+	return &config, nil
+}
+
+// Layers returns the sizes of every layer of the brains being evolved
+func (c *EvolutionConfig) Layers() []int {
+	return append(append([]int{FishBrainInputs}, c.Hidden...), FishBrainOutputs)
+}
+
+// runEvolveCommand evolves fish brains without a window, saving the best genome of each generation.
+//
+//	oceanv2 evolve [-config data/evolution.json] [-out genomes] [-generations 100] [-parallel 0]
+func runEvolveCommand(args []string) error {
+	fs := flag.NewFlagSet("evolve", flag.ContinueOnError)
+	configPath := fs.String("config", DefEvolutionPath, "evolution config file")
+	settingsPath := fs.String("settings", DefSettingsPath, "settings file the config's scenario is applied on top of")
+	outDir := fs.String("out", "genomes", "directory to save the best genomes to")
+	generations := fs.Int("generations", 0, "number of generations to run, overriding the config if positive")
+	parallel := fs.Int("parallel", 0, "number of worlds to run at once, 0 for one per CPU")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config, err := LoadEvolutionConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *generations > 0 {
+		config.Generations = *generations
+	}
+	baseSettings, _, err := LoadSettings(*settingsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if baseSettings, err = config.Scenario.ApplySettings(baseSettings); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	evo, err := NewEvolution(config, baseSettings)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	var best *Genome
+	for gen := 0; gen < config.Generations; gen++ {
+		genBest, mean, err := evo.Step(*parallel)
+		if err != nil {
+			return err
+		}
+		if err := genBest.Save(filepath.Join(*outDir, fmt.Sprintf("gen-%04d.json", gen))); err != nil {
+			return err
+		}
+		if best == nil || genBest.Fitness > best.Fitness {
+			best = genBest
+			if err := best.Save(filepath.Join(*outDir, "best.json")); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "generation %d: best %.2f, mean %.2f, after %s\n", gen, genBest.Fitness, mean, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// Evolution is a population of fish brains, improved one generation at a time by a genetic algorithm
+type Evolution struct {
+	Config     *EvolutionConfig
+	Generation int
+	population []*NeuralNet
+	settings   []*SimulationSettings
+	worlds     []*WorldSnapshot // The scenario built on each seed, before any of the population are added
+	maps       []*Map
+	rng        RNG
+}
+
+// NewEvolution builds the scenario on every seed, and creates a random first generation
+func NewEvolution(config *EvolutionConfig, baseSettings SimulationSettings) (*Evolution, error) {
+	evo := &Evolution{Config: config, rng: NewRNG(config.Seed)}
+	for _, seed := range config.Seeds {
+		settings := baseSettings
+		settings.MapGenerationParams.Seed = seed
+		// The worlds of each seed run in parallel with each other instead of splitting each world's step
+		world, err := config.Scenario.BuildWorld(&settings, 1)
+		if err != nil {
+			return nil, err
+		}
+		evo.settings = append(evo.settings, &settings)
+		evo.worlds = append(evo.worlds, world.Snapshot())
+		evo.maps = append(evo.maps, world.Map)
+	}
+	for i := 0; i < config.Population; i++ {
+		evo.population = append(evo.population, NewRandomNeuralNet(config.Layers(), &evo.rng))
+	}
+	return evo, nil
+}
+
+// Step tests every genome of the current generation and breeds the next one from them.
+// It returns the best genome of the generation that was tested, and the mean fitness.
+func (evo *Evolution) Step(parallel int) (*Genome, float64, error) {
+	scores := make([][]float64, len(evo.worlds))
+	errs := make([]error, len(evo.worlds))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	spawnSeeds := make([]int64, len(evo.worlds))
+	for i := range spawnSeeds {
+		spawnSeeds[i] = evo.rng.Int63()
+	}
+	for i := 0; i < min(NumWorkers(parallel), len(evo.worlds)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range jobs {
+				scores[w], errs[w] = evo.evaluate(w, spawnSeeds[w])
+			}
+		}()
+	}
+	for w := range evo.worlds {
+		jobs <- w
+	}
+	close(jobs)
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, 0, err
+	}
+	// Average in a fixed order, so the result does not depend on which world finished first
+	fitness := make([]float64, len(evo.population))
+	for _, s := range scores {
+		for i := range fitness {
+			fitness[i] += s[i] / float64(len(scores))
+		}
+	}
+
+	// Rank the genomes, keeping the original order between equal fitnesses so evolution is deterministic
+	order := make([]int, len(evo.population))
+	mean := 0.0
+	for i := range order {
+		order[i] = i
+		mean += fitness[i] / float64(len(fitness))
+	}
+	sort.SliceStable(order, func(a, b int) bool { return fitness[order[a]] > fitness[order[b]] })
+	best := &Genome{evo.population[order[0]], fitness[order[0]], evo.Generation}
+
+	next := make([]*NeuralNet, 0, len(evo.population))
+	for _, i := range order[:evo.Config.Elites] {
+		next = append(next, evo.population[i])
+	}
+	for len(next) < len(evo.population) {
+		child := evo.crossover(evo.tournament(fitness), evo.tournament(fitness))
+		evo.mutate(child)
+		next = append(next, child)
+	}
+	evo.population = next
+	evo.Generation++
+	return best, mean, nil
+}
+
+// evaluate runs the whole population together in the world of one seed, and returns the fitness of each genome.
+// Fish die when they run out of energy or touch a predator, and eat food by touching it.
+func (evo *Evolution) evaluate(index int, spawnSeed int64) ([]float64, error) {
+	config := evo.Config
+	settings := evo.settings[index]
+	world := NewWorldWithSettings(evo.maps[index], settings, 1)
+	world.Restore(evo.worlds[index])
+
+	rng := NewRNG(spawnSeed)
+	min, max := pixel.V(config.SpawnMin[0], config.SpawnMin[1]), pixel.V(config.SpawnMax[0], config.SpawnMax[1])
+	genomeOf := make(map[*FishEntity]int, len(evo.population))
+	var alive []*FishEntity
+	for i, net := range evo.population {
+		pos, ok := randomWaterPosition(world.Map, &rng, min, max)
+		if !ok {
+			return nil, errors.New("could not find water to spawn the evolving fish in")
+		}
+		fish, err := NewNeuralFish(pos, &settings.FishSettings, net, rng.Int63())
+		if err != nil {
+			return nil, err
+		}
+		world.Entities.Add(fish)
+		genomeOf[fish] = i
+		alive = append(alive, fish)
+	}
+
+	fitness := make([]float64, len(evo.population))
+	for tick := 0; tick < config.Ticks && len(alive) > 0; tick++ {
+		world.Step()
+		all := world.Entities.All()
+		var dead []*FishEntity
+		for _, fish := range alive {
+			eaten := false
+			// Search far enough to find the largest predators touching the fish
+			world.Grid().Query(fish.Position(), fish.Radius()+2, func(i int) {
+				other := all[i]
+				touching := other.Position().Sub(fish.Position()).Len() < (fish.Radius()+other.Radius())*1.1
+				if !touching {
+					return
+				}
+				if HasTag(other, "predator") {
+					eaten = true
+				} else if HasTag(other, "food") {
+					fish.Feed(config.FoodEnergy)
+					world.Emit(Stimulus{StimulusFeeding, other.Position(), evolveFeedingIntensity, fish})
+					fitness[genomeOf[fish]] += config.Fitness.Food
+					// Food grows back somewhere else, so there is always the same amount to find
+					if pos, ok := randomWaterPosition(world.Map, &rng, world.Map.Bounds().Min, world.Map.Bounds().Max); ok {
+						other.SlideToPosition(pos)
+						other.SetVelocity(pixel.ZV)
+					}
+				}
+			})
+			if eaten {
+				world.Scent.Deposit(ScentDeposit{ScentBlood, fish.Position(), evolveBloodAmount})
+			}
+			if eaten || fish.Energy() <= 0 {
+				dead = append(dead, fish)
+			} else {
+				fitness[genomeOf[fish]] += config.Fitness.Survival * FixedPhysicsTimestep
+			}
+		}
+		// Entities can only be removed after the grid has been used, as it refers to them by index
+		for _, fish := range dead {
+			world.Entities.Remove(fish)
+			alive = slices.DeleteFunc(alive, func(f *FishEntity) bool { return f == fish })
+		}
+	}
+	return fitness, nil
+}
+
+// tournament picks the fittest of a few random genomes
+func (evo *Evolution) tournament(fitness []float64) *NeuralNet {
+	best := evo.rng.Intn(len(evo.population))
+	for i := 1; i < evo.Config.TournamentSize; i++ {
+		if c := evo.rng.Intn(len(evo.population)); fitness[c] > fitness[best] {
+			best = c
+		}
+	}
+	return evo.population[best]
+}
+
+// crossover creates a child taking each weight from one parent or the other at random
+func (evo *Evolution) crossover(a, b *NeuralNet) *NeuralNet {
+	child := &NeuralNet{Layers: a.Layers, Weights: make([]float64, len(a.Weights))}
+	for i := range child.Weights {
+		if evo.rng.Float64() < 0.5 {
+			child.Weights[i] = a.Weights[i]
+		} else {
+			child.Weights[i] = b.Weights[i]
+		}
+	}
+	return child
+}
+
+// mutate nudges some of a new genome's weights by random amounts
+func (evo *Evolution) mutate(n *NeuralNet) {
+	for i := range n.Weights {
+		if evo.rng.Float64() < evo.Config.MutationRate {
+			n.Weights[i] += evo.rng.NormFloat64() * evo.Config.MutationStrength
+		}
+	}
+}
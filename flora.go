@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/gopxl/pixel"
+)
+
+// ScatterKelp grows strands of kelp on top of sand texels that have water above them, adding the segments
+// and the constraints holding them together to the world. The same seed always grows the same kelp.
+func ScatterKelp(w *World, settings FloraSettings, seed int64) {
+	rnd := rand.New(rand.NewSource(seed))
+	texels := w.Map.texels
+	for tx := range texels {
+		for ty := 0; ty < len(texels[tx])-1; ty++ {
+			if texels[tx][ty] != SandTexel || texels[tx][ty+1] != WaterTexel || rnd.Float64() >= settings.KelpDensity {
+				continue
+			}
+			length := settings.MinSegments + rnd.Intn(settings.MaxSegments-settings.MinSegments+1)
+			growKelp(w, pixel.V(float64(tx), float64(ty)+0.5+settings.SegmentRadius), length, settings)
+		}
+	}
+}
+
+// growKelp adds a single strand growing straight up from base, stopping early if it would grow into a solid texel
+func growKelp(w *World, base pixel.Vec, length int, settings FloraSettings) {
+	spacing := settings.SegmentRadius * 2
+	var segments []Entity
+	var last *KelpSegment
+	for i := 0; i < length; i++ {
+		pos := base.Add(pixel.V(0, float64(i)*spacing))
+		if w.Map.IsSolidAt(pos.Add(pixel.V(0, settings.SegmentRadius))) {
+			break
+		}
+		seg := NewKelpSegment(pos, settings.SegmentRadius, i == 0, settings)
+		if last != nil {
+			last.next = seg
+		}
+		last = seg
+		segments = append(segments, seg)
+		w.Entities.Add(seg)
+	}
+	w.AddConstraint(NewChain(segments, settings.MaxBend*math.Pi/180)...)
+}
+
+// coverSegments is the number of plant segments around something for it to be fully hidden
+const coverSegments = 4
+
+// CoverAt returns how hidden something at pos is by plants within radius, between 0 (in the open) and 1 (fully hidden).
+// It uses the broad phase from the last step, so it is safe to call from StepLogic.
+func CoverAt(w *World, pos pixel.Vec, radius float64) float64 {
+	all := w.Entities.All()
+	count := 0
+	w.Grid().Query(pos, radius, func(i int) {
+		if all[i].Position().Sub(pos).Len() < radius && HasTag(all[i], "kelp") {
+			count++
+		}
+	})
+	return math.Min(1, float64(count)/coverSegments)
+}
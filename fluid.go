@@ -0,0 +1,304 @@
+package main
+
+import (
+	"math"
+	"slices"
+
+	"github.com/gopxl/pixel"
+)
+
+// FluidSettings control the optional simulation of the water moving around the map. Apart from Enabled and CellSize,
+// they can be changed while the simulation is running.
+type FluidSettings struct {
+	Enabled    bool    `json:"enabled"`    // Whether the water is simulated at all. It is only checked when a world is built.
+	CellSize   int     `json:"cell-size"`  // Width and height of each fluid cell in texels
+	Interval   int     `json:"interval"`   // Number of ticks between each fluid step
+	Viscosity  float64 `json:"viscosity"`  // How quickly moving water drags the water beside it along
+	Decay      float64 `json:"decay"`      // Fraction of the water's movement lost per second
+	Iterations int     `json:"iterations"` // Number of passes made when spreading movement and keeping the water from compressing
+	Coupling   float64 `json:"coupling"`   // Momentum passed to the water per second for each unit of mass and speed an entity moves through it
+}
+
+// withLive returns the settings with the ones that can be changed while running taken from next.
+// Enabled and CellSize are kept, as they must match the field that was built with them.
+func (s FluidSettings) withLive(next FluidSettings) FluidSettings {
+	next.Enabled, next.CellSize = s.Enabled, s.CellSize
+	return next
+}
+
+// FluidField is the velocity of the water, on a grid of cells much coarser than the map's texels. It is stepped with
+// stable fluids: movement is spread by viscosity, carried along by the flow itself, then corrected so that no water
+// is squeezed into or out of any cell. Every step only depends on the last, so each pass is split across workers.
+//
+// Cells that are mostly rock or air are walls the water can not move through. The sea surface is treated as a wall
+// too, so water flows along under it rather than rising out of the sea.
+// Entities swimming through the water push it along with them, and are dragged along by it in turn.
+type FluidField struct {
+	Settings *FluidSettings
+
+	cellSize      int
+	width, height int       // Number of cells across and up the map
+	water         []bool    // Whether each cell is water, indexed by cx*height+cy
+	cells         []int     // Index of every water cell, in order
+	links         [][4]int  // Index of the cells left of, right of, below and above each water cell, -1 for walls
+	vx, vy        []float64 // Velocity of the water in each cell
+	pressure      []float64 // Kept between steps, as it changes little and is a good first guess for the next
+	nextX, nextY  []float64
+	divergence    []float64
+	nextPressure  []float64
+	momentum      []pixel.Vec // Change in velocity of each cell from the entities in it, gathered before each step
+}
+
+// NewFluidField creates still water covering a map. A cell is water if most of its texels are.
+// The settings are shared, so changing them affects the field while it is running.
+func NewFluidField(m *Map, settings *FluidSettings) *FluidField {
+	size := max(settings.CellSize, 1)
+	texelsWide, texelsHigh := len(m.texels), len(m.texels[0])
+	f := &FluidField{
+		Settings: settings,
+		cellSize: size,
+		width:    (texelsWide + size - 1) / size,
+		height:   (texelsHigh + size - 1) / size,
+	}
+	n := f.width * f.height
+	f.water = make([]bool, n)
+	for cx := 0; cx < f.width; cx++ {
+		for cy := 0; cy < f.height; cy++ {
+			count := 0
+			for tx := cx * size; tx < (cx+1)*size; tx++ {
+				for ty := cy * size; ty < (cy+1)*size; ty++ {
+					if m.IsWater(tx, ty) {
+						count++
+					}
+				}
+			}
+			f.water[cx*f.height+cy] = count*2 > size*size
+		}
+	}
+	for i, water := range f.water {
+		if !water {
+			continue
+		}
+		cx, cy := i/f.height, i%f.height
+		link := [4]int{-1, -1, -1, -1}
+		for k, n := range [4][2]int{{cx - 1, cy}, {cx + 1, cy}, {cx, cy - 1}, {cx, cy + 1}} {
+			if j, ok := f.index(n[0], n[1]); ok {
+				link[k] = j
+			}
+		}
+		f.cells = append(f.cells, i)
+		f.links = append(f.links, link)
+	}
+	f.vx, f.vy, f.pressure = make([]float64, n), make([]float64, n), make([]float64, n)
+	f.nextX, f.nextY = make([]float64, n), make([]float64, n)
+	f.divergence, f.nextPressure = make([]float64, n), make([]float64, n)
+	f.momentum = make([]pixel.Vec, n)
+	return f
+}
+
+// toCell converts a point in the world to cell coordinates, where whole numbers are the centres of cells
+func (f *FluidField) toCell(pos pixel.Vec) pixel.Vec {
+	s := float64(f.cellSize)
+	return pixel.V((pos.X+0.5)/s-0.5, (pos.Y+0.5)/s-0.5)
+}
+
+// index returns where a cell is stored, and whether it is water
+func (f *FluidField) index(cx, cy int) (int, bool) {
+	if cx < 0 || cy < 0 || cx >= f.width || cy >= f.height {
+		return 0, false
+	}
+	i := cx*f.height + cy
+	return i, f.water[i]
+}
+
+// sample interpolates a velocity between the centres of the water cells around a point in cell coordinates.
+// Walls are left out rather than counted as still, like the scent field.
+func (f *FluidField) sample(vx, vy []float64, c pixel.Vec) pixel.Vec {
+	x0, y0 := math.Floor(c.X), math.Floor(c.Y)
+	wx := [2]float64{1 - (c.X - x0), c.X - x0}
+	wy := [2]float64{1 - (c.Y - y0), c.Y - y0}
+	sum, weight := pixel.ZV, 0.0
+	for dx := 0; dx < 2; dx++ {
+		for dy := 0; dy < 2; dy++ {
+			i, ok := f.index(int(x0)+dx, int(y0)+dy)
+			if !ok {
+				continue
+			}
+			w := wx[dx] * wy[dy]
+			sum = sum.Add(pixel.V(vx[i], vy[i]).Scaled(w))
+			weight += w
+		}
+	}
+	if weight == 0 {
+		return pixel.ZV
+	}
+	return sum.Scaled(1 / weight)
+}
+
+// VelocityAt returns the velocity of the water at a point
+func (f *FluidField) VelocityAt(pos pixel.Vec) pixel.Vec {
+	return f.sample(f.vx, f.vy, f.toCell(pos))
+}
+
+// Step moves the water on by one fixed timestep. The fluid is only stepped every Interval ticks, by all of the
+// time since it was last stepped, so it is much cheaper than stepping it with the entities.
+// Entities in the water push on the cell they are in, in order, by how fast they move through it.
+func (f *FluidField) Step(w *World, all []Entity) {
+	interval := max(f.Settings.Interval, 1)
+	if w.Tick%interval != 0 {
+		return
+	}
+	dt := float64(interval) * FixedPhysicsTimestep
+	cellMass := float64(f.cellSize * f.cellSize)
+	for _, e := range all {
+		if e.IsKinematic() || !w.InWater(e.Position()) {
+			continue
+		}
+		c := f.toCell(e.Position())
+		i, ok := f.index(int(math.Round(c.X)), int(math.Round(c.Y)))
+		if !ok {
+			continue
+		}
+		relative := e.Velocity().Sub(f.sample(f.vx, f.vy, c))
+		f.momentum[i] = f.momentum[i].Add(relative.Scaled(f.Settings.Coupling * e.Mass() * dt / cellMass))
+	}
+	for i, m := range f.momentum {
+		f.vx[i] += m.X
+		f.vy[i] += m.Y
+		f.momentum[i] = pixel.ZV
+	}
+
+	f.diffuse(dt, w.workers)
+	f.advect(dt, w.workers)
+	f.project(w.workers)
+}
+
+// forCells calls fn on every water cell, with its neighbours, split across workers
+func (f *FluidField) forCells(workers int, fn func(i int, link [4]int)) {
+	ParallelFor(len(f.cells), workers, func(start, end int) {
+		for k := start; k < end; k++ {
+			fn(f.cells[k], f.links[k])
+		}
+	})
+}
+
+// diffuse spreads movement to neighbouring cells by the viscosity. It is solved implicitly with Jacobi iterations,
+// so it stays stable however viscous the water is. Walls are still, so water slows down as it runs along them.
+func (f *FluidField) diffuse(dt float64, workers int) {
+	a := f.Settings.Viscosity * dt / float64(f.cellSize*f.cellSize)
+	if a <= 0 {
+		return
+	}
+	// The divergence and pressure buffers are free until the water is projected, so hold the starting velocity
+	startX, startY := f.divergence, f.nextPressure
+	copy(startX, f.vx)
+	copy(startY, f.vy)
+	for k := 0; k < f.Settings.Iterations; k++ {
+		vx, vy, nextX, nextY := f.vx, f.vy, f.nextX, f.nextY
+		f.forCells(workers, func(i int, link [4]int) {
+			sumX, sumY := 0.0, 0.0
+			for _, j := range link {
+				if j >= 0 {
+					sumX += vx[j]
+					sumY += vy[j]
+				}
+			}
+			nextX[i] = (startX[i] + a*sumX) / (1 + 4*a)
+			nextY[i] = (startY[i] + a*sumY) / (1 + 4*a)
+		})
+		f.vx, f.nextX = nextX, vx
+		f.vy, f.nextY = nextY, vy
+	}
+}
+
+// advect carries the water's movement along with it, by looking back along the flow to where the water in each
+// cell came from, then fades it by the decay
+func (f *FluidField) advect(dt float64, workers int) {
+	keep := math.Max(1-f.Settings.Decay*dt, 0)
+	scale := dt / float64(f.cellSize)
+	f.forCells(workers, func(i int, link [4]int) {
+		cx, cy := i/f.height, i%f.height
+		from := pixel.V(float64(cx)-f.vx[i]*scale, float64(cy)-f.vy[i]*scale)
+		v := f.sample(f.vx, f.vy, from).Scaled(keep)
+		f.nextX[i], f.nextY[i] = v.X, v.Y
+	})
+	f.vx, f.nextX = f.nextX, f.vx
+	f.vy, f.nextY = f.nextY, f.vy
+}
+
+// project removes any flow into or out of each cell, so the water can not compress. It finds the pressure that
+// would push the extra water away with Jacobi iterations, then moves the water down the pressure gradient.
+// Walls have no flow through them, and take the pressure of the cell beside them.
+func (f *FluidField) project(workers int) {
+	vx, vy := f.vx, f.vy
+	f.forCells(workers, func(i int, link [4]int) {
+		var v [4]float64
+		for k, j := range link {
+			if j >= 0 && k < 2 {
+				v[k] = vx[j]
+			} else if j >= 0 {
+				v[k] = vy[j]
+			}
+		}
+		f.divergence[i] = 0.5 * (v[1] - v[0] + v[3] - v[2])
+	})
+	for k := 0; k < f.Settings.Iterations; k++ {
+		pressure, next := f.pressure, f.nextPressure
+		f.forCells(workers, func(i int, link [4]int) {
+			sum, count := 0.0, 0
+			for _, j := range link {
+				if j >= 0 {
+					sum += pressure[j]
+					count++
+				}
+			}
+			next[i] = 0
+			if count > 0 {
+				next[i] = (sum - f.divergence[i]) / float64(count)
+			}
+		})
+		f.pressure, f.nextPressure = next, pressure
+	}
+	pressure := f.pressure
+	f.forCells(workers, func(i int, link [4]int) {
+		var p [4]float64
+		for k, j := range link {
+			p[k] = pressure[i]
+			if j >= 0 {
+				p[k] = pressure[j]
+			}
+		}
+		vx[i] -= 0.5 * (p[1] - p[0])
+		vy[i] -= 0.5 * (p[3] - p[2])
+	})
+}
+
+// Bounds returns the area of the world covered by the field's cells
+func (f *FluidField) Bounds() pixel.Rect {
+	s := float64(f.cellSize)
+	return pixel.R(-0.5, -0.5, float64(f.width)*s-0.5, float64(f.height)*s-0.5)
+}
+
+// CellCentres calls fn with the centre and velocity of every water cell whose centre is inside a rectangle
+func (f *FluidField) CellCentres(r pixel.Rect, fn func(centre, vel pixel.Vec)) {
+	s := float64(f.cellSize)
+	for cx := 0; cx < f.width; cx++ {
+		for cy := 0; cy < f.height; cy++ {
+			centre := pixel.V(float64(cx)*s+(s-1)/2, float64(cy)*s+(s-1)/2)
+			if i := cx*f.height + cy; f.water[i] && r.Contains(centre) {
+				fn(centre, pixel.V(f.vx[i], f.vy[i]))
+			}
+		}
+	}
+}
+
+// Clone copies the field, so it can be restored later. Which cells are water is shared, as it does not change.
+func (f *FluidField) Clone() *FluidField {
+	clone := *f
+	clone.vx, clone.vy, clone.pressure = slices.Clone(f.vx), slices.Clone(f.vy), slices.Clone(f.pressure)
+	n := len(f.water)
+	clone.nextX, clone.nextY = make([]float64, n), make([]float64, n)
+	clone.divergence, clone.nextPressure = make([]float64, n), make([]float64, n)
+	clone.momentum = make([]pixel.Vec, n)
+	return &clone
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+// BenchmarkFluidStep times one step of the water at the default settings, with the test world's entities stirring it
+func BenchmarkFluidStep(b *testing.B) {
+	world, settings := buildTestWorld(b, 0)
+	field := NewFluidField(world.Map, &settings.Fluid)
+	all := world.Entities.All()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// The field only steps on ticks that are a multiple of its interval, so stay on one
+		world.Tick = 0
+		field.Step(world, all)
+	}
+}
+
+// BenchmarkWorldStep times a whole tick of the test world, with and without the water being simulated
+func BenchmarkWorldStep(b *testing.B) {
+	for _, enabled := range []bool{false, true} {
+		name := "fluid-off"
+		if enabled {
+			name = "fluid-on"
+		}
+		b.Run(name, func(b *testing.B) {
+			world, settings := buildTestWorld(b, 0)
+			if enabled {
+				world.Fluid = NewFluidField(world.Map, &settings.Fluid)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				world.Step()
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/imdraw"
+	"github.com/gopxl/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// Size of each graph on the panel in pixels
+const (
+	graphWidth  = 200
+	graphHeight = 50
+)
+
+// GraphPanel is a metrics sink that keeps a short history of some metrics, and draws them as line graphs
+type GraphPanel struct {
+	lock    sync.Mutex
+	names   []string
+	history map[string][]float64
+	length  int
+	visible bool
+	imd     *imdraw.IMDraw
+	txt     *text.Text
+}
+
+// NewGraphPanel creates a hidden panel showing the last length samples of each named metric
+func NewGraphPanel(length int, names ...string) *GraphPanel {
+	return &GraphPanel{
+		names:   names,
+		history: make(map[string][]float64),
+		length:  length,
+		imd:     imdraw.New(nil),
+		txt:     text.New(pixel.ZV, globalTextAtlas),
+	}
+}
+
+func (g *GraphPanel) WriteSample(sample MetricsSample) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, name := range g.names {
+		h := append(g.history[name], sample.Values[name])
+		if len(h) > g.length {
+			h = h[len(h)-g.length:]
+		}
+		g.history[name] = h
+	}
+	return nil
+}
+
+// Toggle shows or hides the panel
+func (g *GraphPanel) Toggle() {
+	g.visible = !g.visible
+}
+
+// Render draws a graph for each metric, stacked up from the bottom right of the rect
+func (g *GraphPanel) Render(target pixel.Target, rect pixel.Rect) {
+	if !g.visible {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.imd.Clear()
+	g.txt.Clear()
+	for i, name := range g.names {
+		h := g.history[name]
+		min := pixel.V(rect.Max.X-graphWidth-5, rect.Min.Y+5+float64(i)*(graphHeight+5))
+		g.imd.Color = pixel.RGBA{A: 0.6}
+		g.imd.Push(min, min.Add(pixel.V(graphWidth, graphHeight)))
+		g.imd.Rectangle(0)
+		if len(h) == 0 {
+			continue
+		}
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, v := range h {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+		span := hi - lo
+		if span == 0 {
+			span = 1
+		}
+		g.imd.Color = colornames.Lime
+		for j, v := range h {
+			g.imd.Push(min.Add(pixel.V(float64(j)/float64(g.length)*graphWidth, (v-lo)/span*(graphHeight-15))))
+		}
+		g.imd.Line(1)
+		g.txt.Dot = min.Add(pixel.V(3, graphHeight-globalTextAtlas.Ascent()-2))
+		fmt.Fprintf(g.txt, "%s: %.3g [%.3g, %.3g]", name, h[len(h)-1], lo, hi)
+	}
+	g.imd.Draw(target)
+	g.txt.Draw(target, pixel.IM)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// experimentRun is a single headless run of a scenario, with one seed and one value of the swept parameter
+type experimentRun struct {
+	index      int
+	seed       int64
+	paramValue float64
+	settings   *SimulationSettings
+	world      *World
+}
+
+// runExperimentCommand runs scenarios without a window, logging metrics to a CSV file.
+//
+//	oceanv2 run -scenario file.json -ticks 100000 -out results.csv [-every 100] [-seeds 1,2,3] [-sweep fish.thrust=1:10:5]
+//
+// If the output file ends in .jsonl, the metrics are written as JSON lines instead.
+func runExperimentCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	scenarioPath := fs.String("scenario", "", "scenario file describing what to spawn")
+	settingsPath := fs.String("settings", DefSettingsPath, "settings file the scenario is applied on top of")
+	ticks := fs.Int("ticks", 10000, "number of ticks to run each world for")
+	every := fs.Int("every", 100, "number of ticks between each row of metrics")
+	outPath := fs.String("out", "results.csv", "CSV or JSONL file to write metrics to")
+	seedsFlag := fs.String("seeds", "", "comma separated map seeds to run, defaults to the seed in the settings")
+	sweepFlag := fs.String("sweep", "", "parameter to sweep, as path=from:to:steps, for example fish.thrust=1:10:5")
+	parallel := fs.Int("parallel", 0, "number of worlds to run at once, 0 for one per CPU")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *scenarioPath == "" {
+		return errors.New("a scenario must be given with -scenario")
+	}
+	if *every <= 0 {
+		return errors.New("-every must be positive")
+	}
+
+	scenario, err := LoadScenario(*scenarioPath)
+	if err != nil {
+		return err
+	}
+	baseSettings, _, err := LoadSettings(*settingsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	baseSettings, err = scenario.ApplySettings(baseSettings)
+	if err != nil {
+		return err
+	}
+	seeds, err := parseSeeds(*seedsFlag, baseSettings.MapGenerationParams.Seed)
+	if err != nil {
+		return err
+	}
+	sweepParam, sweepValues, err := parseSweep(*sweepFlag)
+	if err != nil {
+		return err
+	}
+
+	// Build every world up front, so we know every metric that will need a column
+	var runs []*experimentRun
+	columns := make(map[string]bool)
+	for _, name := range stepCounterNames {
+		columns[name] = true
+	}
+	for _, value := range sweepValues {
+		for _, seed := range seeds {
+			settings := baseSettings
+			settings.MapGenerationParams.Seed = seed
+			if sweepParam != "" {
+				if err := SetSettingsParam(&settings, sweepParam, value); err != nil {
+					return err
+				}
+			}
+			// Worlds run in parallel with each other instead of splitting each world's step
+			world, err := scenario.BuildWorld(&settings, 1)
+			if err != nil {
+				return err
+			}
+			for name := range SampleWorldGauges(world) {
+				columns[name] = true
+			}
+			runs = append(runs, &experimentRun{len(runs), seed, value, &settings, world})
+		}
+	}
+
+	f, err := os.Create(*outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var sink MetricsSink
+	if strings.HasSuffix(*outPath, ".jsonl") {
+		sink = NewJSONLMetricsSink(f)
+	} else {
+		sink = NewCSVMetricsSink(f, []string{"run", "seed", "param"}, sortedKeys(columns))
+	}
+
+	// Run the worlds, with each one writing its samples as it goes. Once any run fails, no more are started.
+	start := time.Now()
+	jobs := make(chan *experimentRun)
+	errs := make(chan error, len(runs))
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < NumWorkers(*parallel); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range jobs {
+				if err := runExperiment(run, *ticks, *every, sink); err != nil {
+					errs <- fmt.Errorf("run %d (seed %d, param %g): %w", run.index, run.seed, run.paramValue, err)
+					failOnce.Do(func() { close(failed) })
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "finished run %d (seed %d, param %g) after %s\n", run.index, run.seed, run.paramValue, time.Since(start).Round(time.Millisecond))
+			}
+		}()
+	}
+feed:
+	for _, run := range runs {
+		select {
+		case jobs <- run:
+		case <-failed:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return errors.Join(all...)
+}
+
+// runExperiment steps one run's world for a number of ticks, recording its metrics every so many ticks
+func runExperiment(run *experimentRun, ticks, every int, sink MetricsSink) error {
+	metrics := NewMetrics(every, map[string]string{
+		"run":   strconv.Itoa(run.index),
+		"seed":  strconv.FormatInt(run.seed, 10),
+		"param": strconv.FormatFloat(run.paramValue, 'g', -1, 64),
+	}, sink)
+	for tick := 0; tick < ticks; tick++ {
+		run.world.Step()
+		if err := metrics.RecordStep(run.world); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSeeds parses a comma separated list of seeds. If there are none, the default is used, or the time if that is -1.
+func parseSeeds(s string, def int64) ([]int64, error) {
+	if s == "" {
+		if def == -1 {
+			def = time.Now().Unix()
+		}
+		return []int64{def}, nil
+	}
+	var seeds []int64
+	for _, part := range strings.Split(s, ",") {
+		seed, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed %q: %w", part, err)
+		}
+		seeds = append(seeds, seed)
+	}
+	return seeds, nil
+}
+
+// parseSweep parses a sweep in the form path=from:to:steps into the path and every value.
+// With no sweep, there is a single value so every seed still runs once.
+func parseSweep(s string) (string, []float64, error) {
+	if s == "" {
+		return "", []float64{0}, nil
+	}
+	param, rng, ok := strings.Cut(s, "=")
+	parts := strings.Split(rng, ":")
+	if !ok || len(parts) != 3 {
+		return "", nil, fmt.Errorf("invalid sweep %q, expected path=from:to:steps", s)
+	}
+	from, err1 := strconv.ParseFloat(parts[0], 64)
+	to, err2 := strconv.ParseFloat(parts[1], 64)
+	steps, err3 := strconv.Atoi(parts[2])
+	if err := errors.Join(err1, err2, err3); err != nil || steps < 1 {
+		return "", nil, fmt.Errorf("invalid sweep %q, expected path=from:to:steps", s)
+	}
+	values := []float64{from}
+	for i := 1; i < steps; i++ {
+		values = append(values, from+(to-from)*float64(i)/float64(steps-1))
+	}
+	return param, values, nil
+}
+
+// SetSettingsParam sets a single number in the settings, using the JSON names joined by dots (for example fish.thrust)
+func SetSettingsParam(settings *SimulationSettings, path string, value float64) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	var tree map[string]any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	keys := strings.Split(path, ".")
+	node := tree
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := node[k].(map[string]any)
+		if !ok {
+			return fmt.Errorf("unknown settings parameter %q", path)
+		}
+		node = next
+	}
+	last := keys[len(keys)-1]
+	if _, ok := node[last].(float64); !ok {
+		return fmt.Errorf("settings parameter %q is not a number", path)
+	}
+	node[last] = value
+	if data, err = json.Marshal(tree); err != nil {
+		return err
+	}
+	// Integer settings can not be decoded from fractions, so report that rather than silently truncating
+	if err := json.Unmarshal(data, settings); err != nil {
+		return fmt.Errorf("can not set %q to %g: %w", path, value, err)
+	}
+	if err := settings.validate(); err != nil {
+		return fmt.Errorf("can not set %q to %g: %w", path, value, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// HotReloader watches the sprites and settings file, and applies any changes to the running simulation
+type HotReloader struct {
+	watcher      *FileWatcher
+	settingsPath string
+	simSettings  *SimulationSettings
+	userSettings *UserSettings
+	currentMap   *Map
+}
+
+// NewHotReloader starts watching for changes. Changes to settings will be written to simSettings and userSettings.
+func NewHotReloader(settingsPath string, simSettings *SimulationSettings, userSettings *UserSettings, currentMap *Map) *HotReloader {
+	return &HotReloader{
+		watcher:      NewFileWatcher(500*time.Millisecond, SpritesDir, settingsPath),
+		settingsPath: settingsPath,
+		simSettings:  simSettings,
+		userSettings: userSettings,
+		currentMap:   currentMap,
+	}
+}
+
+// Apply reloads anything that has changed since the last call, without blocking.
+// It returns whether any resources were reloaded, and any errors from files that could not be loaded.
+func (h *HotReloader) Apply() (bool, error) {
+	reloaded := false
+	var errs []error
+	for {
+		select {
+		case p := <-h.watcher.Changes():
+			var err error
+			if path.Clean(p) == path.Clean(h.settingsPath) {
+				err = h.reloadSettings()
+			} else {
+				err = ReloadResource(p)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("reload failed: %w", err))
+			} else {
+				reloaded = true
+			}
+		default:
+			if reloaded {
+				h.currentMap.ReloadSprites()
+			}
+			return reloaded, errors.Join(errs...)
+		}
+	}
+}
+
+// Close stops watching for changes
+func (h *HotReloader) Close() {
+	h.watcher.Close()
+}
+
+// reloadSettings reapplies only the settings that can be changed live. Map generation is left alone.
+func (h *HotReloader) reloadSettings() error {
+	simSettings, userSettings, err := LoadSettings(h.settingsPath)
+	if err != nil {
+		return err
+	}
+	h.simSettings.FishSettings = simSettings.FishSettings
+	h.simSettings.Scent = simSettings.Scent
+	h.simSettings.Fluid = h.simSettings.Fluid.withLive(simSettings.Fluid)
+	h.userSettings.CameraSettings = userSettings.CameraSettings
+	h.userSettings.Bindings = userSettings.Bindings
+	return nil
+}
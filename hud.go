@@ -0,0 +1,60 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"time"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+// globalTextAtlas is the font used for all text drawn on the screen
+var globalTextAtlas = text.NewAtlas(basicfont.Face7x13, text.ASCII)
+
+// ScreenMessages is a list of messages shown in the corner of the screen for a short time
+type ScreenMessages struct {
+	messages []screenMessage
+	txt      *text.Text
+	lifetime time.Duration
+}
+
+type screenMessage struct {
+	msg     string
+	col     color.Color
+	created time.Time
+}
+
+// NewScreenMessages creates an empty list of messages, each of which will be shown for lifetime
+func NewScreenMessages(lifetime time.Duration) *ScreenMessages {
+	return &ScreenMessages{
+		txt:      text.New(pixel.ZV, globalTextAtlas),
+		lifetime: lifetime,
+	}
+}
+
+// Add shows a new message with the given colour. Multi-line messages are split up.
+func (s *ScreenMessages) Add(msg string, col color.Color) {
+	for _, line := range strings.Split(msg, "\n") {
+		s.messages = append(s.messages, screenMessage{line, col, time.Now()})
+	}
+}
+
+// Render draws all current messages to the bottom left of the target rect, and removes old messages
+func (s *ScreenMessages) Render(target pixel.Target, rect pixel.Rect) {
+	alive := s.messages[:0]
+	for _, m := range s.messages {
+		if time.Since(m.created) < s.lifetime {
+			alive = append(alive, m)
+		}
+	}
+	s.messages = alive
+	s.txt.Clear()
+	for _, m := range s.messages {
+		s.txt.Color = m.col
+		s.txt.WriteString(m.msg + "\n")
+	}
+	lineHeight := globalTextAtlas.LineHeight()
+	s.txt.Draw(target, pixel.IM.Moved(rect.Min.Add(pixel.V(5, lineHeight*float64(len(s.messages))))))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/pixelgl"
+)
+
+// Names of the actions that can be bound to buttons
+const (
+	ActionPanUp        = "camera.pan.up"
+	ActionPanDown      = "camera.pan.down"
+	ActionPanLeft      = "camera.pan.left"
+	ActionPanRight     = "camera.pan.right"
+	ActionZoomIn       = "camera.zoom.in"
+	ActionZoomOut      = "camera.zoom.out"
+	ActionDrag         = "camera.drag" // Held while dragging the mouse to pan
+	ActionFollow       = "camera.follow"
+	ActionSelect       = "select" // Select the entity under the mouse
+	ActionScatter      = "sim.scatter"
+	ActionSplash       = "sim.splash"
+	ActionPause        = "sim.pause"
+	ActionStep         = "sim.step"
+	ActionSlower       = "sim.slower"
+	ActionFaster       = "sim.faster"
+	ActionSaveReplay   = "replay.save"
+	ActionSeekBack     = "replay.seek.back"
+	ActionSeekForward  = "replay.seek.forward"
+	ActionRestart      = "replay.restart"
+	ActionRecordedCam  = "replay.camera" // Toggle using the camera from the recording
+	ActionDebugToggle  = "debug.toggle"
+	ActionGraphsToggle = "graphs.toggle"
+	ActionSpawnTool    = "spawn.toggle"
+	ActionSpawnPlace   = "spawn.place" // Held to keep spraying entities
+	ActionSpawnNext    = "spawn.next"
+	ActionSpawnPrev    = "spawn.prev"
+	ActionSpawnMore    = "spawn.count.up"
+	ActionSpawnLess    = "spawn.count.down"
+)
+
+// InputBindings maps each action to the names of the buttons that trigger it, such as "W", "Space" or "MouseButtonRight".
+// Button names are the same as pixelgl uses.
+type InputBindings map[string][]string
+
+// DefaultBindings are the bindings used for any action not set in the user settings
+var DefaultBindings = func() InputBindings {
+	b := InputBindings{
+		ActionPanUp:        {"W"},
+		ActionPanDown:      {"S"},
+		ActionPanLeft:      {"A"},
+		ActionPanRight:     {"D"},
+		ActionZoomIn:       {"E"},
+		ActionZoomOut:      {"Q"},
+		ActionDrag:         {"MouseButtonRight"},
+		ActionFollow:       {"F"},
+		ActionSelect:       {"MouseButtonLeft"},
+		ActionScatter:      {"B"},
+		ActionSplash:       {"V"},
+		ActionPause:        {"Space"},
+		ActionStep:         {"Period"},
+		ActionSlower:       {"LeftBracket"},
+		ActionFaster:       {"RightBracket"},
+		ActionSaveReplay:   {"F5"},
+		ActionSeekBack:     {"Left"},
+		ActionSeekForward:  {"Right"},
+		ActionRestart:      {"Home"},
+		ActionRecordedCam:  {"C"},
+		ActionDebugToggle:  {"GraveAccent"},
+		ActionGraphsToggle: {"M"},
+		ActionSpawnTool:    {"T"},
+		ActionSpawnPlace:   {"MouseButtonLeft"},
+		ActionSpawnNext:    {"X"},
+		ActionSpawnPrev:    {"Z"},
+		ActionSpawnMore:    {"Equal"},
+		ActionSpawnLess:    {"Minus"},
+	}
+	// The number keys toggle each debug layer in turn, with 0 for the tenth
+	for l := range debugLayerNames {
+		b[DebugLayerAction(DebugLayer(l))] = []string{fmt.Sprint((l + 1) % 10)}
+	}
+	return b
+}()
+
+// Clone returns a copy of the bindings that can be changed without affecting the original
+func (b InputBindings) Clone() InputBindings {
+	clone := make(InputBindings, len(b))
+	for action, buttons := range b {
+		clone[action] = append([]string(nil), buttons...)
+	}
+	return clone
+}
+
+// buttonsByName finds pixelgl buttons from their names
+var buttonsByName = func() map[string]pixelgl.Button {
+	names := make(map[string]pixelgl.Button)
+	for b := pixelgl.MouseButton1; b <= pixelgl.KeyLast; b++ {
+		if name := b.String(); name != "Invalid" {
+			names[name] = b
+		}
+	}
+	return names
+}()
+
+// InputMap translates buttons into named actions, so code reacts to actions rather than specific keys.
+// Actions can also be injected, to drive the simulation without a window.
+type InputMap struct {
+	bindings    map[string][]pixelgl.Button
+	pressed     map[string]bool
+	justPressed map[string]bool
+	repeated    map[string]bool
+	injected    []string
+
+	mousePos, mousePrevPos, scroll pixel.Vec
+}
+
+// NewInputMap creates an input map with the given bindings. If some buttons are not recognised the map is still
+// usable, with those buttons left out, and an error is returned listing them.
+func NewInputMap(bindings InputBindings) (*InputMap, error) {
+	m := &InputMap{
+		pressed:     make(map[string]bool),
+		justPressed: make(map[string]bool),
+		repeated:    make(map[string]bool),
+	}
+	return m, m.SetBindings(bindings)
+}
+
+// SetBindings replaces the bindings. Unrecognised buttons are left out and returned in an error.
+func (m *InputMap) SetBindings(bindings InputBindings) error {
+	m.bindings = make(map[string][]pixelgl.Button, len(bindings))
+	var unknown []string
+	for action, names := range bindings {
+		for _, name := range names {
+			b, ok := buttonsByName[name]
+			if !ok {
+				unknown = append(unknown, fmt.Sprintf("%q (%s)", name, action))
+				continue
+			}
+			m.bindings[action] = append(m.bindings[action], b)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown buttons in bindings: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Update reads the state of every action from the window, along with any actions injected since the last update.
+// It should be called once per frame after the window updates. win may be nil to only use injected actions.
+func (m *InputMap) Update(win *pixelgl.Window) {
+	clear(m.pressed)
+	clear(m.justPressed)
+	clear(m.repeated)
+	m.scroll = pixel.ZV
+	if win != nil {
+		for action, buttons := range m.bindings {
+			for _, b := range buttons {
+				m.pressed[action] = m.pressed[action] || win.Pressed(b)
+				m.justPressed[action] = m.justPressed[action] || win.JustPressed(b)
+				m.repeated[action] = m.repeated[action] || win.Repeated(b)
+			}
+		}
+		m.SetMouse(win.MousePosition(), win.MousePreviousPosition(), win.MouseScroll())
+	}
+	for _, action := range m.injected {
+		m.pressed[action] = true
+		m.justPressed[action] = true
+	}
+	m.injected = m.injected[:0]
+}
+
+// Inject presses an action for the next update only, as if one of its buttons had just been pressed
+func (m *InputMap) Inject(action string) {
+	m.injected = append(m.injected, action)
+}
+
+// SetMouse sets the mouse position, its position on the last update, and the scroll since the last update
+func (m *InputMap) SetMouse(pos, prevPos, scroll pixel.Vec) {
+	m.mousePos, m.mousePrevPos, m.scroll = pos, prevPos, scroll
+}
+
+// Pressed returns whether any button of the action is held down
+func (m *InputMap) Pressed(action string) bool { return m.pressed[action] }
+
+// JustPressed returns whether a button of the action was pressed since the last update
+func (m *InputMap) JustPressed(action string) bool { return m.justPressed[action] }
+
+// Repeated returns whether a button of the action was pressed or held long enough to repeat since the last update
+func (m *InputMap) Repeated(action string) bool {
+	return m.justPressed[action] || m.repeated[action]
+}
+
+func (m *InputMap) MousePosition() pixel.Vec         { return m.mousePos }
+func (m *InputMap) MousePreviousPosition() pixel.Vec { return m.mousePrevPos }
+func (m *InputMap) MouseScroll() pixel.Vec           { return m.scroll }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/imdraw"
+	"github.com/gopxl/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// Inspector keeps track of a selected entity, and draws a panel showing its live state
+type Inspector struct {
+	selected Entity
+	txt      *text.Text
+	imd      *imdraw.IMDraw
+}
+
+// NewInspector creates an inspector with nothing selected
+func NewInspector() *Inspector {
+	return &Inspector{
+		txt: text.New(pixel.ZV, globalTextAtlas),
+		imd: imdraw.New(nil),
+	}
+}
+
+// Select selects an entity to inspect, or clears the selection if e is nil
+func (in *Inspector) Select(e Entity) {
+	in.selected = e
+}
+
+// Selected returns the selected entity, or nil if there is none
+func (in *Inspector) Selected() Entity {
+	return in.selected
+}
+
+// InspectFields returns all of the fields shown when inspecting an entity
+func InspectFields(e Entity) []DebugField {
+	fields := []DebugField{
+		{"type", fmt.Sprintf("%T", e)},
+		{"tags", strings.Join(e.Tags(), ", ")},
+		{"position", fmt.Sprintf("(%.2f, %.2f)", e.Position().X, e.Position().Y)},
+		{"velocity", fmt.Sprintf("(%.2f, %.2f) |%.2f|", e.Velocity().X, e.Velocity().Y, e.Velocity().Len())},
+		{"acceleration", fmt.Sprintf("(%.2f, %.2f)", e.Acceleration().X, e.Acceleration().Y)},
+		{"mass", fmt.Sprintf("%.2f", e.Mass())},
+		{"radius", fmt.Sprintf("%.2f", e.Radius())},
+		{"kinematic", fmt.Sprint(e.IsKinematic())},
+	}
+	if di, ok := e.(DebugInspectable); ok {
+		fields = append(fields, di.DebugFields()...)
+	}
+	return fields
+}
+
+// Render highlights the selected entity in the world, and draws the stats panel in the top left of the target rect
+func (in *Inspector) Render(target pixel.Target, rect pixel.Rect, camera *Camera) {
+	if in.selected == nil {
+		return
+	}
+	in.txt.Clear()
+	in.txt.Color = colornames.White
+	for _, f := range InspectFields(in.selected) {
+		fmt.Fprintf(in.txt, "%-14s %s\n", f.Name+":", f.Value)
+	}
+	panelSize := in.txt.Bounds().Size().Add(pixel.V(10, 10))
+	panelTopLeft := pixel.V(rect.Min.X, rect.Max.Y)
+
+	in.imd.Clear()
+	in.imd.Color = colornames.Yellow
+	in.imd.Push(camera.WorldToScreen(in.selected.Position()))
+	in.imd.Circle(in.selected.Radius()*camera.PixelsPerMeter+2, 1)
+	in.imd.Color = pixel.RGBA{A: 0.6}
+	in.imd.Push(panelTopLeft, panelTopLeft.Add(pixel.V(panelSize.X, -panelSize.Y)))
+	in.imd.Rectangle(0)
+	in.imd.Draw(target)
+
+	in.txt.Draw(target, pixel.IM.Moved(panelTopLeft.Add(pixel.V(5, -5-globalTextAtlas.Ascent()))))
+}
@@ -1,24 +1,43 @@
 package main
 
 import (
-	"math"
-	"math/rand"
+	"flag"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/gopxl/pixel"
 	"github.com/gopxl/pixel/pixelgl"
+	"github.com/gopxl/pixel/text"
 	"golang.org/x/image/colornames"
 )
 
+// replayKeyframeInterval is the number of ticks between each snapshot kept while playing a replay
+const replayKeyframeInterval = 600
+
 func main() {
-	// Ensure graphics are on main thread
-	pixelgl.Run(run)
+	var err error
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "run":
+		// Headless commands do not need a window
+		err = runExperimentCommand(os.Args[2:])
+	case len(os.Args) > 1 && os.Args[1] == "evolve":
+		err = runEvolveCommand(os.Args[2:])
+	case len(os.Args) > 1 && os.Args[1] == "replay":
+		err = replayCommand(os.Args[2:])
+	default:
+		// Ensure graphics are on main thread
+		pixelgl.Run(run)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-func run() {
-	// Create a window
+func newWindow(title string) *pixelgl.Window {
 	cfg := pixelgl.WindowConfig{
-		Title:  "Boids Terrain",
+		Title:  title,
 		Bounds: pixel.R(0, 0, 800, 800),
 		VSync:  true,
 	}
@@ -26,113 +45,309 @@ func run() {
 	if err != nil {
 		panic(err)
 	}
-	var settings = DefSimSettings
+	return win
+}
+
+// replayCommand plays back a replay file in a window, or with -verify checks it reproduces without a window
+//
+//	oceanv2 replay [-verify] file.json
+func replayCommand(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	verify := fs.Bool("verify", false, "re-simulate the replay without a window, and check it ends in the recorded state")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected a single replay file")
+	}
+	replay, err := LoadReplay(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	player, err := NewReplayPlayer(replay, replay.Settings.Workers, replayKeyframeInterval)
+	if err != nil {
+		return err
+	}
+	if *verify {
+		if err := player.Verify(); err != nil {
+			return err
+		}
+		fmt.Printf("replay reproduced exactly after %d ticks\n", player.World.Tick)
+		return nil
+	}
+	_, userSettings, err := LoadSettings(DefSettingsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	pixelgl.Run(func() {
+		runReplay(newWindow("Boids Terrain - Replay"), player, userSettings)
+	})
+	return nil
+}
+
+func run() {
+	// Create a window
+	win := newWindow("Boids Terrain")
+	settings, userSettings, err := LoadSettings(DefSettingsPath)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "failed to load settings, using defaults:", err)
+	}
 	if settings.MapGenerationParams.Seed == -1 {
 		settings.MapGenerationParams.Seed = time.Now().Unix()
 	}
-	runSimulation(win, settings, DefUserSettings)
+	runSimulation(win, settings, userSettings)
 }
 
 func runSimulation(win *pixelgl.Window, simSettings SimulationSettings, userSettings UserSettings) {
-	// Setup the camera
-	cameraWorldPos := pixel.V(20, 80)
-	currentPixelsPerMeter := 50.0
-
-	// Generate a new map
-	currentMap := NewGeneratedMap(simSettings.MapGenerationParams)
+	// Generate a new map, and create the world and its entities
+	world, err := DefaultScenario.BuildWorld(&simSettings, simSettings.Workers)
+	if err != nil {
+		panic(err)
+	}
+	currentMap := world.Map
 
-	// Create the entities
-	entities := NewEntitiesContainer()
-	for i := 0; i < 500; i++ {
-		entities.Add(NewFish(pixel.V(float64(i)*1+2, 250)))
+	// Record everything that changes the world, so the run can be saved as a replay with F5
+	recorder := NewReplayRecorder(simSettings, DefaultScenario)
+	applyEvent := func(ev ReplayEvent) error {
+		recorder.Record(world, ev)
+		return ApplyReplayEvent(world, &simSettings, ev)
 	}
+	inputRNG := NewRNG(time.Now().UnixNano())
+
+	// Setup the camera
+	camera := NewCamera(pixel.V(20, 80), 50, &userSettings.CameraSettings)
+	camera.SetBounds(currentMap.Bounds())
+	var lastCamera ReplayEvent
 
 	// Create the batch so we can draw all entities at once
 	entitiesBatch := pixel.NewBatch(&pixel.TrianglesData{}, GetSpritePicture("entities"))
 
+	// Watch for changes to sprites and settings, and show any problems on screen
+	messages := NewScreenMessages(5 * time.Second)
+	hotReloader := NewHotReloader(DefSettingsPath, &simSettings, &userSettings, currentMap)
+	defer hotReloader.Close()
+
+	// Clicking on an entity selects it for inspection
+	inspector := NewInspector()
+
+	// While the spawn tool is enabled, clicking places entities instead of selecting them
+	spawnTool := NewSpawnTool(inputRNG.Int63())
+
+	// The overlay draws extra information to help debugging, and M shows graphs of the metrics
+	debugOverlay := NewDebugOverlay(&simSettings)
+	var debugStats DebugStats
+	graphPanel := NewGraphPanel(200, "time:step", "time:render", "collisions", "polarization")
+	metrics := NewMetrics(10, nil, graphPanel)
+
+	// The simulation can be paused, stepped a tick at a time, and sped up or slowed down
+	timeControl := NewTimeControl()
+
+	// Buttons are turned into actions, using the bindings from the user settings
+	input, err := NewInputMap(userSettings.Bindings)
+	if err != nil {
+		messages.Add(err.Error(), colornames.Red)
+	}
+
 	// Update loop
+	lastFrameTime := time.Now()
 	for !win.Closed() {
+		debugStats.FrameTime = time.Since(lastFrameTime)
+		frameDT := debugStats.FrameTime.Seconds()
+		lastFrameTime = time.Now()
+
 		// Read keypresses and wipe the window
 		win.Update()
+		input.Update(win)
 		win.Clear(colornames.Black)
 
-		// Process player input to move the camera around
-		spd := userSettings.CameraSettings.MoveSpeed / currentPixelsPerMeter
-		if win.Pressed(pixelgl.KeyW) {
-			cameraWorldPos = cameraWorldPos.Add(pixel.V(0, spd/60.0))
-		} else if win.Pressed(pixelgl.KeyS) {
-			cameraWorldPos = cameraWorldPos.Add(pixel.V(0, -spd/60.0))
-		}
-		if win.Pressed(pixelgl.KeyA) {
-			cameraWorldPos = cameraWorldPos.Add(pixel.V(-spd/60.0, 0))
-		} else if win.Pressed(pixelgl.KeyD) {
-			cameraWorldPos = cameraWorldPos.Add(pixel.V(spd/60.0, 0))
-		}
-		scaleSpd := 1.0
-		if win.Pressed(pixelgl.KeyQ) {
-			scaleSpd = 1.0 / math.Pow(userSettings.CameraSettings.ZoomSpeed, 1.0/60)
-		} else if win.Pressed(pixelgl.KeyE) {
-			scaleSpd = math.Pow(userSettings.CameraSettings.ZoomSpeed, 1.0/60)
-		}
-		currentPixelsPerMeter *= scaleSpd
-
-		if win.JustPressed(pixelgl.KeyB) {
-			for _, e := range entities.All() {
-				if !e.IsKinematic() {
-					e.ApplyImpulse(pixel.V(50, 0).Rotated(rand.Float64() * 3.14159 * 2))
-				}
+		// Apply any changes to files on disk, recording changes to the simulation so replays match
+		fishSettings, scentSettings, fluidSettings := simSettings.FishSettings, simSettings.Scent, simSettings.Fluid
+		reloaded, err := hotReloader.Apply()
+		if err != nil {
+			messages.Add(err.Error(), colornames.Red)
+		}
+		if reloaded {
+			entitiesBatch = pixel.NewBatch(&pixel.TrianglesData{}, GetSpritePicture("entities"))
+			messages.Add("reloaded resources", colornames.White)
+			if err := input.SetBindings(userSettings.Bindings); err != nil {
+				messages.Add(err.Error(), colornames.Red)
 			}
 		}
+		if simSettings.FishSettings != fishSettings {
+			newFishSettings := simSettings.FishSettings
+			applyEvent(ReplayEvent{Type: ReplayFishSettings, FishSettings: &newFishSettings})
+		}
+		if simSettings.Scent != scentSettings {
+			newScentSettings := simSettings.Scent
+			applyEvent(ReplayEvent{Type: ReplayScentSettings, ScentSettings: &newScentSettings})
+		}
+		if simSettings.Fluid != fluidSettings {
+			newFluidSettings := simSettings.Fluid
+			applyEvent(ReplayEvent{Type: ReplayFluidSettings, FluidSettings: &newFluidSettings})
+		}
 
-		// Update logic for entities
-		for _, e := range entities.All() {
-			e.StepLogic()
+		// Process player input to move the camera around.
+		// Following toggles between the selected entity, or the school if nothing is selected.
+		if input.JustPressed(ActionFollow) {
+			if camera.IsFollowing() {
+				camera.StopFollowing()
+			} else if selected := inspector.Selected(); selected != nil {
+				camera.Follow(selected)
+			} else {
+				camera.FollowCentroid(func() []Entity { return world.Entities.WithTag("fish") })
+			}
+		}
+		camera.Update(input, win.Bounds(), frameDT)
+		if camera.Position != lastCamera.Position || camera.PixelsPerMeter != lastCamera.Zoom {
+			lastCamera = ReplayEvent{Type: ReplayCamera, Position: camera.Position, Zoom: camera.PixelsPerMeter}
+			applyEvent(lastCamera)
 		}
 
-		// Update forces and integrate kinematics
-		for _, e := range entities.All() {
-			if !e.IsKinematic() {
-				e.StepPhysics()
+		spawns, refused := spawnTool.Update(input, camera, world.Map, frameDT)
+		for _, ev := range spawns {
+			if err := applyEvent(ev); err != nil {
+				messages.Add(err.Error(), colornames.Red)
 			}
 		}
+		if refused > 0 && input.JustPressed(ActionSpawnPlace) {
+			messages.Add(fmt.Sprintf("cannot spawn %d %s inside solid ground", refused, spawnTool.Selected()), colornames.Orange)
+		}
+		if !spawnTool.Enabled && input.JustPressed(ActionSelect) {
+			inspector.Select(world.Entities.AtPoint(camera.ScreenToWorld(input.MousePosition())))
+		}
+		debugOverlay.HandleInput(input)
+		if input.JustPressed(ActionGraphsToggle) {
+			graphPanel.Toggle()
+		}
 
-		// Process collisions and ensure the solver ends in a valid state
-		for i, e := range entities.All() {
-			CollideMapEntity(currentMap, e)
-			for j, e2 := range entities.All() {
-				if j <= i {
-					continue
-				}
-				CollideEntityEntity(e, e2)
+		if input.JustPressed(ActionScatter) {
+			applyEvent(ReplayEvent{Type: ReplayScatter, Seed: inputRNG.Int63()})
+		}
+		if input.JustPressed(ActionSplash) {
+			applyEvent(ReplayEvent{Type: ReplaySplash, Position: camera.ScreenToWorld(input.MousePosition())})
+		}
+		if input.JustPressed(ActionSaveReplay) {
+			path := fmt.Sprintf("replay-%d.json", time.Now().Unix())
+			if err := recorder.Save(world, path); err != nil {
+				messages.Add(err.Error(), colornames.Red)
+			} else {
+				messages.Add("saved replay to "+path, colornames.White)
 			}
 		}
 
-		// Create the render data to draw map with
-		renderData := &RenderData{
-			Target:         win,
-			TargetRect:     win.Bounds(),
-			CameraWorldPos: cameraWorldPos,
-			PixelsPerMeter: currentPixelsPerMeter,
+		// Step the world forward as many ticks as the current speed needs
+		timeControl.HandleInput(input)
+		tickStart := time.Now()
+		for i, n := 0, timeControl.TicksThisFrame(); i < n; i++ {
+			world.Step()
+			if err := metrics.RecordStep(world); err != nil {
+				messages.Add(err.Error(), colornames.Red)
+			}
 		}
+		debugStats.TickTime = time.Since(tickStart)
+		debugStats.Entities = len(world.Entities.All())
+		debugStats.CollisionPairs = world.LastCollisions()
+
+		renderStart := time.Now()
+		renderWorld(win, camera, world, entitiesBatch)
+		metrics.AddFrameDuration("time:render", time.Since(renderStart))
 
-		// Render the current map
-		currentMap.Render(renderData)
+		// Debug information is drawn over the top of the world
+		debugOverlay.Render(win, camera, world, inspector.Selected(), debugStats)
+		inspector.Render(win, win.Bounds(), camera)
+		graphPanel.Render(win, win.Bounds())
+		spawnTool.Render(win, win.Bounds())
+		timeControl.Render(win, win.Bounds())
+		messages.Render(win, win.Bounds())
+	}
+}
 
-		// Create the render data to draw entities with
-		renderDataEntities := &RenderData{
-			Target:         entitiesBatch,
-			TargetRect:     win.Bounds(),
-			CameraWorldPos: cameraWorldPos,
-			PixelsPerMeter: currentPixelsPerMeter,
+// runReplay plays back a replay in a window. The time controls work as they do in the simulation,
+// and as well as these it can seek, and switch between the recorded camera and a free camera.
+func runReplay(win *pixelgl.Window, player *ReplayPlayer, userSettings UserSettings) {
+	world := player.World
+	camera := NewCamera(pixel.V(20, 80), 50, &userSettings.CameraSettings)
+	camera.SetBounds(world.Map.Bounds())
+	useRecordedCamera := true
+	entitiesBatch := pixel.NewBatch(&pixel.TrianglesData{}, GetSpritePicture("entities"))
+	messages := NewScreenMessages(5 * time.Second)
+	status := text.New(pixel.ZV, globalTextAtlas)
+	input, err := NewInputMap(userSettings.Bindings)
+	if err != nil {
+		messages.Add(err.Error(), colornames.Red)
+	}
+
+	lastFrameTime := time.Now()
+	for !win.Closed() {
+		frameDT := time.Since(lastFrameTime).Seconds()
+		lastFrameTime = time.Now()
+		win.Update()
+		input.Update(win)
+		win.Clear(colornames.Black)
+
+		// Playback controls
+		var err error
+		switch {
+		case input.JustPressed(ActionPause):
+			player.Paused = !player.Paused
+		case input.Repeated(ActionStep):
+			player.Paused = true
+			err = player.StepTick()
+		case input.Repeated(ActionSeekBack):
+			err = player.Seek(world.Tick - int(5/FixedPhysicsTimestep))
+		case input.Repeated(ActionSeekForward):
+			err = player.Seek(world.Tick + int(5/FixedPhysicsTimestep))
+		case input.JustPressed(ActionRestart):
+			err = player.Seek(0)
+		case input.JustPressed(ActionFaster):
+			player.Speed *= 2
+		case input.JustPressed(ActionSlower):
+			player.Speed /= 2
+		case input.JustPressed(ActionRecordedCam):
+			useRecordedCamera = !useRecordedCamera
+		}
+		if err == nil {
+			err = player.Advance(frameDT)
 		}
+		if err != nil {
+			messages.Add(err.Error(), colornames.Red)
+			player.Paused = true
+		}
+
+		if rec := player.Camera(); useRecordedCamera && rec != nil {
+			camera.Position, camera.PixelsPerMeter = rec.Position, rec.Zoom
+		}
+		camera.Update(input, win.Bounds(), frameDT)
 
-		// Render all of the entities
-		entitiesBatch.Clear()
-		for _, e := range entities.All() {
-			e.Render(renderDataEntities)
+		renderWorld(win, camera, world, entitiesBatch)
+		state := "playing"
+		if player.Paused {
+			state = "paused"
+		} else if player.Finished() {
+			state = "finished"
 		}
-		entitiesBatch.Draw(win)
+		status.Clear()
+		fmt.Fprintf(status, "%s  tick %d / %d  speed %gx", state, world.Tick, player.Ticks(), player.Speed)
+		status.Draw(win, pixel.IM.Moved(pixel.V(5, win.Bounds().H()-20)))
+		messages.Render(win, win.Bounds())
+	}
+}
+
+// renderWorld draws the map and then all entities, as seen by the camera
+func renderWorld(win *pixelgl.Window, camera *Camera, world *World, entitiesBatch *pixel.Batch) {
+	// Render the current map
+	world.Map.Render(camera.RenderData(win, win.Bounds()))
+	world.Map.RenderSurface(camera.RenderData(win, win.Bounds()), world.Time())
+
+	// Create the render data to draw entities with
+	renderDataEntities := camera.RenderData(entitiesBatch, win.Bounds())
+
+	// Render all of the entities
+	entitiesBatch.Clear()
+	for _, e := range world.Entities.All() {
+		e.Render(renderDataEntities)
 	}
+	entitiesBatch.Draw(win)
 }
 
 func (e *FishEntity) Tags() []string {
@@ -22,8 +22,14 @@ const (
 	WaterTexel Texel = iota
 	RockTexel
 	SandTexel
+	AirTexel // Above the highest waves, so never underwater
 )
 
+// Solid returns whether entities can not move through the texel
+func (t Texel) Solid() bool {
+	return t != WaterTexel && t != AirTexel
+}
+
 // Map is used to store information about the envrionment, primarily the texels
 type Map struct {
 	texels       [][]Texel
@@ -32,6 +38,10 @@ type Map struct {
 	texelsCanvas *pixelgl.Canvas
 	imd          *imdraw.IMDraw
 	dirty        bool
+	light        [][]float64
+	environment  *Environment
+	surfaceImd   *imdraw.IMDraw
+	Surface      SurfaceParams
 }
 
 // NewGeneratedMap generates a new environment using the given params.
@@ -57,29 +67,44 @@ func NewGeneratedMap(genParams MapGenerationParams) *Map {
 					// Terrain rock
 					texels[tx][ty] = RockTexel
 				}
+			} else if float64(ty) > genParams.Surface.Level+genParams.Surface.WaveHeight {
+				// Air above the highest waves
+				texels[tx][ty] = AirTexel
 			} else {
-				// Terrain air
+				// Open water
 				texels[tx][ty] = WaterTexel
 			}
 		}
 	}
-	spriteSheet := GetSpritePicture("textures")
-	spritesMap := make(map[Texel]*pixel.Sprite)
-	spritesMap[RockTexel] = spriteFromTileSheet(spriteSheet, 0, 14, mapTextureTexelWidth)
-	spritesMap[WaterTexel] = spriteFromTileSheet(spriteSheet, 0, 1, mapTextureTexelWidth)
-	spritesMap[SandTexel] = spriteFromTileSheet(spriteSheet, 0, 6, mapTextureTexelWidth)
-
-	return &Map{
-		texels:       texels,
-		spriteSheet:  spriteSheet,
-		sprites:      spritesMap,
-		dirty:        true,
-		texelsCanvas: pixelgl.NewCanvas(pixel.R(0, 0, float64(mapTextureTexelWidth*genParams.Length), float64(mapTextureTexelWidth*genParams.Height))),
-		imd:          imdraw.New(nil),
+	m := &Map{
+		texels:     texels,
+		dirty:      true,
+		imd:        imdraw.New(nil),
+		surfaceImd: imdraw.New(nil),
+		Surface:    genParams.Surface,
 	}
+	m.ReloadSprites()
+	m.computeLight()
+	m.environment = generateEnvironment(m, genParams.Environment, genParams.Seed)
+	return m
+}
+
+// ReloadSprites fetches the texel sprites from the global resources again, and marks the map to be re-rendered
+func (m *Map) ReloadSprites() {
+	m.spriteSheet = GetSpritePicture("textures")
+	m.sprites = make(map[Texel]*pixel.Sprite)
+	m.sprites[RockTexel] = spriteFromTileSheet(m.spriteSheet, 0, 14, mapTextureTexelWidth)
+	m.sprites[WaterTexel] = spriteFromTileSheet(m.spriteSheet, 0, 1, mapTextureTexelWidth)
+	m.sprites[SandTexel] = spriteFromTileSheet(m.spriteSheet, 0, 6, mapTextureTexelWidth)
+	m.dirty = true
 }
 
 func (m *Map) Render(rd *RenderData) {
+	// The canvas is only created when first rendering, so maps can be used without a window
+	if m.texelsCanvas == nil {
+		m.texelsCanvas = pixelgl.NewCanvas(pixel.R(0, 0, float64(mapTextureTexelWidth*len(m.texels)), float64(mapTextureTexelWidth*len(m.texels[0]))))
+		m.dirty = true
+	}
 	if m.dirty {
 		m.texelsCanvas.Clear(pixel.Alpha(0))
 		m.imd.Clear()
@@ -90,13 +115,16 @@ func (m *Map) Render(rd *RenderData) {
 				worldPos := pixel.V(float64(tx), float64(ty))
 				//depth := m.GetDepthAt(worldPos)
 				light := m.GetLightAt(worldPos)
-				if texel != WaterTexel {
+				if texel.Solid() {
 					sprite := m.sprites[texel]
 					drawMat := pixel.IM.Moved(screenPos)
 					sprite.Draw(m.texelsCanvas, drawMat)
 				} else {
 					col := pixel.ToRGBA(colornames.Skyblue).Scaled(light).Add(pixel.ToRGBA(pixel.RGB(17.0/255, 42.0/255, 82.0/255)).Scaled(1 - light))
 					//col = col.Scaled(light)
+					if texel == AirTexel {
+						col = pixel.ToRGBA(mapSkyColour)
+					}
 					m.imd.Color = col
 					squareRad := float64(mapTextureTexelWidth) / 2
 					m.imd.Push(screenPos.Sub(pixel.V(squareRad, squareRad)), screenPos.Add(pixel.V(squareRad, squareRad)))
@@ -110,32 +138,180 @@ func (m *Map) Render(rd *RenderData) {
 	m.texelsCanvas.Draw(rd.Target, pixel.IM.Moved(m.texelsCanvas.Bounds().Center()).Scaled(pixel.ZV, 1.0/float64(mapTextureTexelWidth)).Moved(rd.CameraWorldPos.Scaled(-1)).Scaled(pixel.ZV, rd.PixelsPerMeter).Moved(rd.TargetRect.Center()))
 }
 
+// mapSkyColour is the colour of the air above the sea
+var mapSkyColour = colornames.Lightskyblue
+
+// RenderSurface draws the sky over any water texels that the waves have dipped below at a time in seconds,
+// with a line along the top of the water
+func (m *Map) RenderSurface(rd *RenderData, t float64) {
+	toScreen := func(v pixel.Vec) pixel.Vec {
+		return v.Sub(rd.CameraWorldPos).Scaled(rd.PixelsPerMeter).Add(rd.TargetRect.Center())
+	}
+	halfWidth := rd.TargetRect.W() / 2 / rd.PixelsPerMeter
+	bounds := m.Bounds()
+	minX, maxX := math.Max(rd.CameraWorldPos.X-halfWidth, bounds.Min.X), math.Min(rd.CameraWorldPos.X+halfWidth, bounds.Max.X)
+	// The texels the waves move through reach half a texel above the highest crest
+	top := math.Floor(m.Surface.Level+m.Surface.WaveHeight) + 0.5
+	// Use a few pixels per segment, so it stays smooth when zoomed in and cheap when zoomed out
+	step := math.Max(4/rd.PixelsPerMeter, 0.1)
+	m.surfaceImd.Clear()
+	for x := minX; x < maxX; x += step {
+		x2 := math.Min(x+step, maxX)
+		y, y2 := m.Surface.SurfaceAt(x, t), m.Surface.SurfaceAt(x2, t)
+		// Leave islands poking through the surface alone
+		if m.IsSolidAt(pixel.V(x, y)) {
+			continue
+		}
+		m.surfaceImd.Color = mapSkyColour
+		m.surfaceImd.Push(toScreen(pixel.V(x, y)), toScreen(pixel.V(x2, y2)), toScreen(pixel.V(x2, top)), toScreen(pixel.V(x, top)))
+		m.surfaceImd.Polygon(0)
+		m.surfaceImd.Color = colornames.White
+		m.surfaceImd.Push(toScreen(pixel.V(x, y)), toScreen(pixel.V(x2, y2)))
+		m.surfaceImd.Line(1)
+	}
+	m.surfaceImd.Draw(rd.Target)
+}
+
 // spriteFromTileSheet extracts a single sprite from a tilesheet of uniform sized square tiles
 func spriteFromTileSheet(pic pixel.Picture, coordx, coordy int, tileSize int) *pixel.Sprite {
 	sprite := pixel.NewSprite(pic, pixel.R(float64(coordx*tileSize), float64(coordy*tileSize), float64((coordx+1)*tileSize), float64((coordy+1)*tileSize)))
 	return sprite
 }
 
-// Returns the depth, between 1 and 0, of the provided point
+// Bounds returns the area of the world covered by the map's texels
+func (m *Map) Bounds() pixel.Rect {
+	return pixel.R(-0.5, -0.5, float64(len(m.texels))-0.5, float64(len(m.texels[0]))-0.5)
+}
+
+// Returns the depth below the calm sea surface, between 1 at the bottom of the map and 0 at or above the surface
 func (m *Map) GetDepthAt(pos pixel.Vec) float64 {
-	return 1 - pos.Y/float64(len(m.texels[0]))
+	return pixel.Clamp(1-pos.Y/m.Surface.Level, 0, 1)
 }
 
-// Returns the light level between 0 and 1 of the provided point
+// Returns the light level between 0 and 1 of the provided point. Points outside the map are dark.
 func (m *Map) GetLightAt(pos pixel.Vec) float64 {
 	xPos := int(math.Round(pos.X))
 	yPos := int(math.Round(pos.Y))
-	covered := false
-	// -1 is here so the top border does not cover
-	for y := yPos; y < len(m.texels[xPos])-1; y++ {
-		if m.texels[xPos][y] != WaterTexel {
-			covered = true
-			break
+	if xPos < 0 || yPos < 0 || xPos >= len(m.light) || yPos >= len(m.light[xPos]) {
+		return 0
+	}
+	return m.light[xPos][yPos]
+}
+
+// computeLight caches the light level at the centre of every texel.
+// The air is fully lit, and water is lit if there is nothing solid above it, getting darker the deeper it is.
+func (m *Map) computeLight() {
+	m.light = make([][]float64, len(m.texels))
+	for tx := range m.texels {
+		m.light[tx] = make([]float64, len(m.texels[tx]))
+		covered := false
+		// -1 is here so the top border does not cover
+		for ty := len(m.texels[tx]) - 2; ty >= 0; ty-- {
+			if m.texels[tx][ty].Solid() {
+				covered = true
+			}
+			if m.texels[tx][ty] == AirTexel && !covered {
+				m.light[tx][ty] = 1
+			} else if !covered {
+				m.light[tx][ty] = 1 - m.GetDepthAt(pixel.V(float64(tx), float64(ty)))
+			}
+		}
+	}
+}
+
+// IsSolidAt returns whether the texel containing the point is solid ground. Points outside the map are solid.
+func (m *Map) IsSolidAt(pos pixel.Vec) bool {
+	return m.IsSolid(int(math.Round(pos.X)), int(math.Round(pos.Y)))
+}
+
+// IsSolid returns whether the texel at the coordinate is solid ground. Coordinates outside the map are solid.
+func (m *Map) IsSolid(tx, ty int) bool {
+	if tx < 0 || ty < 0 || tx >= len(m.texels) || ty >= len(m.texels[tx]) {
+		return true
+	}
+	return m.texels[tx][ty].Solid()
+}
+
+// IsWaterAt returns whether the texel containing the point is water, rather than solid ground or air
+func (m *Map) IsWaterAt(pos pixel.Vec) bool {
+	return m.IsWater(int(math.Round(pos.X)), int(math.Round(pos.Y)))
+}
+
+// IsWater returns whether the texel at the coordinate is water, rather than solid ground or air.
+// Texels the waves pass through are water, even while a trough leaves them above the surface.
+func (m *Map) IsWater(tx, ty int) bool {
+	return !m.IsSolid(tx, ty) && m.texels[tx][ty] == WaterTexel
+}
+
+// Raycast walks from a point in a direction until it hits a solid texel or travels maxDist.
+// It returns whether something was hit, and the distance travelled.
+func (m *Map) Raycast(from, dir pixel.Vec, maxDist float64) (bool, float64) {
+	hit, hitDist := false, maxDist
+	m.walkTexels(from, dir, maxDist, func(tx, ty int, dist float64) bool {
+		if m.IsSolid(tx, ty) {
+			hit, hitDist = true, dist
+			return false
 		}
+		return true
+	})
+	return hit, hitDist
+}
+
+// SolidTexelsBetween counts the solid texels on the straight line between two points
+func (m *Map) SolidTexelsBetween(from, to pixel.Vec) int {
+	count := 0
+	m.walkTexels(from, to.Sub(from), to.Sub(from).Len(), func(tx, ty int, dist float64) bool {
+		if m.IsSolid(tx, ty) {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// walkTexels calls visit for every texel a ray passes through, in order, with the distance along the ray where it
+// enters the texel, until it travels maxDist or visit returns false
+func (m *Map) walkTexels(from, dir pixel.Vec, maxDist float64, visit func(tx, ty int, dist float64) bool) {
+	dir = dir.Unit()
+	// Texels are centred on integer coordinates, so shift by half a texel to walk a grid with integer boundaries
+	origin := from.Add(pixel.V(0.5, 0.5))
+	tx, ty := int(math.Floor(origin.X)), int(math.Floor(origin.Y))
+	if !visit(tx, ty, 0) {
+		return
+	}
+	stepX, stepY := 1, 1
+	if dir.X < 0 {
+		stepX = -1
 	}
-	if covered {
-		return 0.0
-	} else {
-		return 1 - m.GetDepthAt(pos)
+	if dir.Y < 0 {
+		stepY = -1
+	}
+	// Distance along the ray to cross one whole texel on each axis, and to reach the next boundary on each axis
+	deltaX, deltaY := math.Abs(1/dir.X), math.Abs(1/dir.Y)
+	nextX, nextY := math.Inf(1), math.Inf(1)
+	if dir.X > 0 {
+		nextX = (math.Floor(origin.X) + 1 - origin.X) * deltaX
+	} else if dir.X < 0 {
+		nextX = (origin.X - math.Floor(origin.X)) * deltaX
+	}
+	if dir.Y > 0 {
+		nextY = (math.Floor(origin.Y) + 1 - origin.Y) * deltaY
+	} else if dir.Y < 0 {
+		nextY = (origin.Y - math.Floor(origin.Y)) * deltaY
+	}
+	for {
+		var dist float64
+		if nextX < nextY {
+			dist = nextX
+			tx += stepX
+			nextX += deltaX
+		} else {
+			dist = nextY
+			ty += stepY
+			nextY += deltaY
+		}
+		if dist > maxDist || !visit(tx, ty, dist) {
+			return
+		}
 	}
 }
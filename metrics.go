@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetricsSample is the value of every metric over one interval, along with labels describing where it came from
+type MetricsSample struct {
+	Tick   int
+	Labels map[string]string
+	Values map[string]float64
+}
+
+// MetricsSink receives samples from Metrics. Sinks may be shared between several Metrics, so must be safe to use concurrently.
+type MetricsSink interface {
+	WriteSample(MetricsSample) error
+}
+
+// stepCounterNames are the counters recorded every step
+var stepCounterNames = []string{"time:logic", "time:scent", "time:fluid", "time:physics", "time:constraints", "time:collisions", "time:step", "collisions"}
+
+// Metrics collects measurements from a world every step, and sends a sample to its sinks every interval ticks.
+//
+// Counters, such as timings and collisions, are added every tick and reported as a mean per tick.
+// Frame counters, such as the render time, are added once per frame drawn and reported as a mean per frame, as a frame
+// may run several ticks, or none while paused.
+// Gauges, such as populations and flocking order, are measured from the world when the sample is sent.
+type Metrics struct {
+	interval int
+	labels   map[string]string
+	sinks    []MetricsSink
+	sums     map[string]float64
+	ticks    int
+
+	frameSums   map[string]float64
+	frameCounts map[string]int
+}
+
+// NewMetrics creates metrics sending a sample every interval ticks to all of the sinks, labelling every sample with labels
+func NewMetrics(interval int, labels map[string]string, sinks ...MetricsSink) *Metrics {
+	return &Metrics{
+		interval: interval,
+		labels:   labels,
+		sinks:    sinks,
+		sums:     make(map[string]float64),
+
+		frameSums:   make(map[string]float64),
+		frameCounts: make(map[string]int),
+	}
+}
+
+// Add adds to a counter for this tick
+func (m *Metrics) Add(name string, value float64) {
+	m.sums[name] += value
+}
+
+// AddDuration adds a duration to a counter for this tick, in milliseconds
+func (m *Metrics) AddDuration(name string, d time.Duration) {
+	m.Add(name, float64(d.Microseconds())/1000)
+}
+
+// AddFrameDuration adds a duration to a frame counter for this frame, in milliseconds
+func (m *Metrics) AddFrameDuration(name string, d time.Duration) {
+	m.frameSums[name] += float64(d.Microseconds()) / 1000
+	m.frameCounts[name]++
+}
+
+// RecordStep should be called after every step of the world. It records the step's counters,
+// and sends a sample to the sinks if the interval is over.
+func (m *Metrics) RecordStep(w *World) error {
+	timings := w.LastTimings()
+	m.AddDuration("time:logic", timings.Logic)
+	m.AddDuration("time:scent", timings.Scent)
+	m.AddDuration("time:fluid", timings.Fluid)
+	m.AddDuration("time:physics", timings.Physics)
+	m.AddDuration("time:constraints", timings.Constraints)
+	m.AddDuration("time:collisions", timings.Collisions)
+	m.AddDuration("time:step", timings.Logic+timings.Scent+timings.Fluid+timings.Physics+timings.Constraints+timings.Collisions)
+	m.Add("collisions", float64(w.LastCollisions()))
+	m.ticks++
+	if m.ticks < m.interval {
+		return nil
+	}
+
+	sample := MetricsSample{Tick: w.Tick, Labels: m.labels, Values: make(map[string]float64)}
+	for name, sum := range m.sums {
+		sample.Values[name] = sum / float64(m.ticks)
+		m.sums[name] = 0
+	}
+	m.ticks = 0
+	for name, sum := range m.frameSums {
+		if m.frameCounts[name] > 0 {
+			sample.Values[name] = sum / float64(m.frameCounts[name])
+		}
+		m.frameSums[name], m.frameCounts[name] = 0, 0
+	}
+	for name, value := range SampleWorldGauges(w) {
+		sample.Values[name] = value
+	}
+	var errs []error
+	for _, s := range m.sinks {
+		errs = append(errs, s.WriteSample(sample))
+	}
+	return errors.Join(errs...)
+}
+
+// SampleWorldGauges measures the current state of a world. Populations are named "population:<tag>".
+func SampleWorldGauges(w *World) map[string]float64 {
+	gauges := make(map[string]float64)
+	for tag, entities := range w.Entities.taggedEntities {
+		gauges["population:"+tag] = float64(len(entities))
+	}
+	totalSpeed, moving := 0.0, 0
+	for _, e := range w.Entities.All() {
+		if !e.IsKinematic() {
+			totalSpeed += e.Velocity().Len()
+			moving++
+		}
+	}
+	gauges["entities"] = float64(len(w.Entities.All()))
+	if moving > 0 {
+		gauges["mean-speed"] = totalSpeed / float64(moving)
+	}
+	fish := w.Entities.WithTag("fish")
+	gauges["polarization"] = Polarization(fish)
+	gauges["milling"] = Milling(fish)
+	return gauges
+}
+
+// Polarization is how aligned the directions of a group of entities are, between 0 (random) and 1 (all the same way)
+func Polarization(entities []Entity) float64 {
+	total := 0.0
+	sumX, sumY := 0.0, 0.0
+	for _, e := range entities {
+		v := e.Velocity()
+		if v.Len() == 0 {
+			continue
+		}
+		u := v.Unit()
+		sumX, sumY = sumX+u.X, sumY+u.Y
+		total++
+	}
+	if total == 0 {
+		return 0
+	}
+	return math.Hypot(sumX, sumY) / total
+}
+
+// Milling is how much a group of entities is circling around its centre, between 0 (not at all) and 1 (a perfect mill)
+func Milling(entities []Entity) float64 {
+	if len(entities) == 0 {
+		return 0
+	}
+	cx, cy := 0.0, 0.0
+	for _, e := range entities {
+		cx, cy = cx+e.Position().X, cy+e.Position().Y
+	}
+	cx, cy = cx/float64(len(entities)), cy/float64(len(entities))
+	total, count := 0.0, 0
+	for _, e := range entities {
+		r, v := e.Position(), e.Velocity()
+		r.X, r.Y = r.X-cx, r.Y-cy
+		if r.Len() == 0 || v.Len() == 0 {
+			continue
+		}
+		total += r.Unit().Cross(v.Unit())
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return math.Abs(total) / float64(count)
+}
+
+// CSVMetricsSink writes samples as rows of a CSV file, with the labels, then the tick, then the values.
+// The columns are either given up front, or taken from the first sample. Values without a column are not written.
+type CSVMetricsSink struct {
+	lock          sync.Mutex
+	out           *csv.Writer
+	labelNames    []string
+	valueNames    []string
+	headerWritten bool
+}
+
+// NewCSVMetricsSink creates a sink writing to w. If valueNames is nil, the columns are chosen from the first sample.
+func NewCSVMetricsSink(w io.Writer, labelNames, valueNames []string) *CSVMetricsSink {
+	return &CSVMetricsSink{out: csv.NewWriter(w), labelNames: labelNames, valueNames: valueNames}
+}
+
+func (s *CSVMetricsSink) WriteSample(sample MetricsSample) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.headerWritten {
+		if s.valueNames == nil {
+			s.labelNames, s.valueNames = sortedKeys(sample.Labels), sortedKeys(sample.Values)
+		}
+		header := append(append(append([]string{}, s.labelNames...), "tick"), s.valueNames...)
+		if err := s.out.Write(header); err != nil {
+			return err
+		}
+		s.headerWritten = true
+	}
+	row := make([]string, 0, len(s.labelNames)+len(s.valueNames)+1)
+	for _, l := range s.labelNames {
+		row = append(row, sample.Labels[l])
+	}
+	row = append(row, strconv.Itoa(sample.Tick))
+	for _, v := range s.valueNames {
+		if value, ok := sample.Values[v]; ok {
+			row = append(row, strconv.FormatFloat(value, 'g', 6, 64))
+		} else {
+			row = append(row, "")
+		}
+	}
+	if err := s.out.Write(row); err != nil {
+		return err
+	}
+	s.out.Flush()
+	return s.out.Error()
+}
+
+// JSONLMetricsSink writes each sample as a single line of JSON, with the labels and values flattened into one object
+type JSONLMetricsSink struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewJSONLMetricsSink creates a sink writing to w
+func NewJSONLMetricsSink(w io.Writer) *JSONLMetricsSink {
+	return &JSONLMetricsSink{enc: json.NewEncoder(w)}
+}
+
+func (s *JSONLMetricsSink) WriteSample(sample MetricsSample) error {
+	line := make(map[string]any, len(sample.Labels)+len(sample.Values)+1)
+	for k, v := range sample.Labels {
+		line[k] = v
+	}
+	for k, v := range sample.Values {
+		line[k] = v
+	}
+	line["tick"] = sample.Tick
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.enc.Encode(line)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// NeuralNet is a small fully connected feed-forward network with tanh activations.
+// Its weights do not change once created, so one network can be shared by many entities.
+type NeuralNet struct {
+	Layers []int `json:"layers"` // Number of neurons in each layer, from the inputs to the outputs
+	// For each neuron after the input layer, its bias followed by a weight for every neuron in the previous layer
+	Weights []float64 `json:"weights"`
+}
+
+// NewRandomNeuralNet creates a network with the given layer sizes and random weights,
+// scaled so that each neuron starts with a similar range of outputs no matter how many inputs it has
+func NewRandomNeuralNet(layers []int, rng *RNG) *NeuralNet {
+	n := &NeuralNet{Layers: append([]int(nil), layers...)}
+	n.Weights = make([]float64, 0, neuralWeightCount(layers))
+	for l := 1; l < len(layers); l++ {
+		scale := 1 / math.Sqrt(float64(layers[l-1]+1))
+		for i := 0; i < layers[l]*(layers[l-1]+1); i++ {
+			n.Weights = append(n.Weights, (rng.Float64()*2-1)*scale)
+		}
+	}
+	return n
+}
+
+// neuralWeightCount is how many weights and biases a network with the given layer sizes has
+func neuralWeightCount(layers []int) int {
+	count := 0
+	for l := 1; l < len(layers); l++ {
+		count += layers[l] * (layers[l-1] + 1)
+	}
+	return count
+}
+
+// Validate checks that the network has at least an input and output layer, and the right number of weights
+func (n *NeuralNet) Validate() error {
+	if len(n.Layers) < 2 {
+		return fmt.Errorf("neural net needs at least 2 layers, has %d", len(n.Layers))
+	}
+	for _, size := range n.Layers {
+		if size <= 0 {
+			return fmt.Errorf("neural net layers must not be empty")
+		}
+	}
+	if want := neuralWeightCount(n.Layers); len(n.Weights) != want {
+		return fmt.Errorf("neural net with layers %v needs %d weights, has %d", n.Layers, want, len(n.Weights))
+	}
+	return nil
+}
+
+// Inputs returns the number of inputs the network takes
+func (n *NeuralNet) Inputs() int { return n.Layers[0] }
+
+// Outputs returns the number of outputs the network gives
+func (n *NeuralNet) Outputs() int { return n.Layers[len(n.Layers)-1] }
+
+// BufferSize is the length of the scratch buffer Forward needs
+func (n *NeuralNet) BufferSize() int {
+	largest := 0
+	for _, size := range n.Layers {
+		largest = max(largest, size)
+	}
+	return largest * 2
+}
+
+// Forward runs the inputs through the network, returning each output between -1 and 1.
+// buf is scratch space of at least BufferSize, so the network can be used concurrently without allocating.
+// The outputs are stored in buf, so they are only valid until it is used again.
+func (n *NeuralNet) Forward(inputs, buf []float64) []float64 {
+	half := len(buf) / 2
+	in, out := buf[:half:half], buf[half:]
+	copy(in, inputs)
+	in = in[:len(inputs)]
+	w := 0
+	for l := 1; l < len(n.Layers); l++ {
+		out = out[:n.Layers[l]]
+		for i := range out {
+			sum := n.Weights[w]
+			w++
+			for _, x := range in {
+				sum += n.Weights[w] * x
+				w++
+			}
+			out[i] = math.Tanh(sum)
+		}
+		in, out = out, in[:cap(in)]
+	}
+	return in
+}
+
+// Genome is an evolved network saved to disk, along with how well it did
+type Genome struct {
+	Net        *NeuralNet `json:"net"`
+	Fitness    float64    `json:"fitness"`
+	Generation int        `json:"generation"`
+}
+
+// LoadGenome reads and checks a genome file
+func LoadGenome(path string) (*Genome, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g := &Genome{}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	if g.Net == nil {
+		return nil, fmt.Errorf("genome %s has no net", path)
+	}
+	if err := g.Net.Validate(); err != nil {
+		return nil, fmt.Errorf("genome %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// Save writes the genome to a file
+func (g *Genome) Save(path string) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
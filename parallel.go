@@ -0,0 +1,37 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// NumWorkers returns the number of workers to use for a requested count, where 0 or less means one per CPU
+func NumWorkers(requested int) int {
+	if requested <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return requested
+}
+
+// ParallelFor splits the range [0, n) into one contiguous chunk per worker, and calls f on each chunk concurrently.
+// It returns once every chunk is done. With one worker, or a small n, f is just called on the calling goroutine.
+func ParallelFor(n, workers int, f func(start, end int)) {
+	if workers <= 1 || n < workers*2 {
+		f(0, n)
+		return
+	}
+	chunkSize := (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += chunkSize {
+		end := start + chunkSize
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			f(start, end)
+		}(start, end)
+	}
+	wg.Wait()
+}
@@ -6,20 +6,33 @@ import (
 	"github.com/gopxl/pixel"
 )
 
-// CollideEntityEntity collides two entities together and moves them to new correct positions
-func CollideEntityEntity(e1, e2 Entity) {
+// CollideEntityEntity collides two entities together and moves them to new correct positions.
+// It returns whether the entities were touching.
+func CollideEntityEntity(e1, e2 Entity) bool {
 	delta := e1.Position().Sub(e2.Position())
 	dist := delta.Len()
 	overlap := (e1.Radius() + e2.Radius()) - dist
 	if overlap > 0 {
-		correction := delta.Scaled(overlap / dist / 2)
-		e1.SlideToPosition(e1.Position().Add(correction))
-		e2.SlideToPosition(e2.Position().Sub(correction))
+		// Heavier entities move less, and kinematic entities do not move at all
+		correctPair(e1, e2, delta.Scaled(overlap/dist))
+		return true
 	}
+	return false
 }
 
-// CollideMapEntity moves an entity to a new valid position after colliding it with a map
-func CollideMapEntity(m *Map, e Entity) {
+// CollisionSettings control how entities collide with the map
+type CollisionSettings struct {
+	SweepSpeed float64 `json:"sweep-speed"` // Entities faster than this are swept along their path, so they can not jump through thin walls
+}
+
+// CollideMapEntity moves an entity to a new valid position after colliding it with a map.
+// Entities that moved faster than sweepSpeed in the last step are first stopped where they hit a wall, in case they
+// passed right through it. Kinematic entities are left where they are.
+func CollideMapEntity(m *Map, e Entity, sweepSpeed float64) {
+	if e.IsKinematic() {
+		return
+	}
+	SweepMapEntity(m, e, sweepSpeed)
 	texelRadius := int(math.Round(e.Radius() + 0.5))
 	texelPosX := int(math.Round(e.Position().X))
 	texelPosY := int(math.Round(e.Position().Y))
@@ -27,7 +40,7 @@ func CollideMapEntity(m *Map, e Entity) {
 	numDetectedCollisions := 0
 	for tx := texelPosX - texelRadius; tx <= texelPosX+texelRadius; tx++ {
 		for ty := texelPosY - texelRadius; ty <= texelPosY+texelRadius; ty++ {
-			if tx >= 0 && ty >= 0 && tx < len(m.texels) && ty < len(m.texels[tx]) && m.texels[tx][ty] != WaterTexel {
+			if tx >= 0 && ty >= 0 && tx < len(m.texels) && ty < len(m.texels[tx]) && m.texels[tx][ty].Solid() {
 				// Incorrect but good enough for now - approximate all squares to be circles
 				delta := e.Position().Sub(pixel.V(float64(tx), float64(ty)))
 				dist := delta.Len()
@@ -45,10 +58,84 @@ func CollideMapEntity(m *Map, e Entity) {
 	}
 }
 
+// SweepMapEntity moves an entity back along the path it took in the last step, to the first solid texel it hit, and
+// stops it moving into that texel. Only the end position is checked for overlaps otherwise, so anything that moves
+// further than its own radius in a step could jump over a thin wall. Entities no faster than minSpeed are not swept.
+// Long paths are split into substeps no longer than the radius, so only the texels near each substep need to be
+// tested. It returns whether the entity hit anything.
+func SweepMapEntity(m *Map, e Entity, minSpeed float64) bool {
+	from := e.PreviousPosition()
+	delta := e.Position().Sub(from)
+	dist := delta.Len()
+	if dist == 0 || dist <= minSpeed*FixedPhysicsTimestep {
+		return false
+	}
+	substeps := int(math.Ceil(dist / math.Max(e.Radius(), sweepMinStep)))
+	for s := 0; s < substeps; s++ {
+		a := from.Add(delta.Scaled(float64(s) / float64(substeps)))
+		b := from.Add(delta.Scaled(float64(s+1) / float64(substeps)))
+		if t, normal, hit := sweepTexels(m, a, b, e.Radius()+0.5); hit {
+			vel := e.Velocity()
+			e.SlideToPosition(a.Add(b.Sub(a).Scaled(t)))
+			// Keep sliding along the wall, but not into it, or the next step would carry it straight through
+			e.SetVelocity(vel.Sub(normal.Scaled(math.Min(vel.Dot(normal), 0))))
+			return true
+		}
+	}
+	return false
+}
+
+// sweepMinStep is the shortest substep used by SweepMapEntity, so tiny entities are not split into huge numbers of them
+const sweepMinStep = 0.25
+
+// sweepTexels finds how far along the segment from a to b a circle first touches a solid texel, as a fraction of the
+// segment, and the direction from the texel to the circle when they touch. Texels are treated as circles, so the circle
+// touches one when its centre comes within reach of the texel's. Texels the circle already overlaps at a are ignored,
+// as it is pushed out of them from the end position.
+func sweepTexels(m *Map, a, b pixel.Vec, reach float64) (float64, pixel.Vec, bool) {
+	d := b.Sub(a)
+	dd := d.Dot(d)
+	first, normal, hit := 1.0, pixel.ZV, false
+	minX, maxX := int(math.Floor(math.Min(a.X, b.X)-reach)), int(math.Ceil(math.Max(a.X, b.X)+reach))
+	minY, maxY := int(math.Floor(math.Min(a.Y, b.Y)-reach)), int(math.Ceil(math.Max(a.Y, b.Y)+reach))
+	for tx := max(minX, 0); tx <= min(maxX, len(m.texels)-1); tx++ {
+		for ty := max(minY, 0); ty <= min(maxY, len(m.texels[tx])-1); ty++ {
+			if !m.texels[tx][ty].Solid() {
+				continue
+			}
+			// Solve |a + t*d - c| = reach for the earliest t
+			centre := pixel.V(float64(tx), float64(ty))
+			ac := a.Sub(centre)
+			c := ac.Dot(ac) - reach*reach
+			half := d.Dot(ac)
+			disc := half*half - dd*c
+			if c <= 0 || half >= 0 || disc < 0 {
+				continue
+			}
+			if t := (-half - math.Sqrt(disc)) / dd; t <= first {
+				first, hit = t, true
+				normal = a.Add(d.Scaled(t)).Sub(centre).Unit()
+			}
+		}
+	}
+	return first, normal, hit
+}
+
 func DragForce(vel pixel.Vec, coeff float64) pixel.Vec {
 	return pixel.V(math.Abs(vel.X)*vel.X, math.Abs(vel.Y)*vel.Y).Scaled(-coeff)
 }
 
+// StableDragForce is DragForce, limited so that it can at most stop an entity of the given mass within a single step.
+// Strong drag on light entities would otherwise overshoot, and grow each step until the entity explodes.
+func StableDragForce(vel pixel.Vec, coeff, mass float64) pixel.Vec {
+	drag := DragForce(vel, coeff)
+	maxDrag := vel.Len() * mass / FixedPhysicsTimestep
+	if l := drag.Len(); l > maxDrag {
+		drag = drag.Scaled(maxDrag / l)
+	}
+	return drag
+}
+
 func SignedAngleBetween(a, b pixel.Vec) float64 {
 	au, bu := a.Unit(), b.Unit()
 
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gopxl/pixel"
+)
+
+// newWallMap creates a map of water with a wall one texel thick wherever wall returns true
+func newWallMap(size int, wall func(tx, ty int) bool) *Map {
+	texels := make([][]Texel, size)
+	for tx := range texels {
+		texels[tx] = make([]Texel, size)
+		for ty := range texels[tx] {
+			if wall(tx, ty) {
+				texels[tx][ty] = RockTexel
+			}
+		}
+	}
+	return &Map{texels: texels}
+}
+
+// TestSweepStopsFastEntities fires entities at thin walls as fast as a scatter sends them, at several angles, and
+// checks that they never end up on the far side
+func TestSweepStopsFastEntities(t *testing.T) {
+	const size = 128
+	walls := []struct {
+		name  string
+		wall  func(tx, ty int) bool
+		side  func(pos pixel.Vec) float64 // Positive on the side the entities start on
+		start pixel.Vec
+		in    pixel.Vec // Direction straight into the wall
+	}{
+		{"horizontal", func(tx, ty int) bool { return ty == size/2 }, func(p pixel.Vec) float64 { return size/2 - p.Y }, pixel.V(size/2, size/2-4), pixel.V(0, 1)},
+		{"vertical", func(tx, ty int) bool { return tx == size/2 }, func(p pixel.Vec) float64 { return size/2 - p.X }, pixel.V(size/2-4, size/2), pixel.V(1, 0)},
+		{"diagonal", func(tx, ty int) bool { return tx == ty }, func(p pixel.Vec) float64 { return p.Y - p.X }, pixel.V(size/2-3, size/2+3), pixel.V(1, -1).Unit()},
+	}
+	for _, wall := range walls {
+		m := newWallMap(size, wall.wall)
+		for _, speed := range []float64{scatterImpulse / 4, scatterImpulse, scatterImpulse * 4} {
+			for _, angle := range []float64{-60, -30, 0, 30, 60} {
+				for _, radius := range []float64{0.3, 1} {
+					e := NewDummyEntity(wall.start, radius, 1)
+					e.SetVelocity(wall.in.Rotated(angle * math.Pi / 180).Scaled(speed))
+					for tick := 0; tick < 10; tick++ {
+						e.StepPhysics()
+						CollideMapEntity(m, e, DefSimSettings.Collision.SweepSpeed)
+						if wall.side(e.Position()) <= 0 {
+							t.Errorf("%s wall: entity of radius %g at %g m/s and %g degrees went through to %v on tick %d",
+								wall.name, radius, speed, angle, e.Position(), tick)
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestSweepSkipsSlowEntities checks that entities no faster than the sweep speed are only collided at the end of
+// each step, even when they are right beside a wall
+func TestSweepSkipsSlowEntities(t *testing.T) {
+	m := newWallMap(32, func(tx, ty int) bool { return tx == 16 })
+	tests := []struct {
+		name       string
+		speed      float64
+		sweepSpeed float64
+		swept      bool
+	}{
+		{"swimming", 2, DefSimSettings.Collision.SweepSpeed, false},
+		{"just under the sweep speed", DefSimSettings.Collision.SweepSpeed * 0.99, DefSimSettings.Collision.SweepSpeed, false},
+		{"scattered", scatterImpulse, DefSimSettings.Collision.SweepSpeed, true},
+		{"scattered with a higher sweep speed", scatterImpulse, scatterImpulse * 2, false},
+	}
+	for _, test := range tests {
+		e := NewDummyEntity(pixel.V(16-1.5, 16), 0.5, 1)
+		e.SetVelocity(pixel.V(test.speed, 0))
+		e.StepPhysics()
+		if swept := SweepMapEntity(m, e, test.sweepSpeed); swept != test.swept {
+			t.Errorf("%s: swept %v, expected %v", test.name, swept, test.swept)
+		}
+	}
+}
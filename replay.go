@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gopxl/pixel"
+)
+
+// Types of event that can be recorded in a replay
+const (
+	ReplayScatter       = "scatter"        // Push every entity in a random direction
+	ReplaySplash        = "splash"         // Make a splash stimulus at a position
+	ReplaySpawn         = "spawn"          // Spawn an entity
+	ReplayCamera        = "camera"         // Move the camera, this does not affect the world
+	ReplayFishSettings  = "fish-settings"  // Change the fish settings
+	ReplayScentSettings = "scent-settings" // Change how scents spread and fade
+	ReplayFluidSettings = "fluid-settings" // Change how the water flows
+)
+
+// scatterImpulse is the size of the impulse applied to every entity by a scatter
+const scatterImpulse = 50
+
+// splashIntensity is how loud a splash made by the user is
+const splashIntensity = 20
+
+// Replay is a recording of a run, made of the settings and scenario to build the starting world,
+// and every input that changed the world since. As the world is deterministic, this reproduces the run exactly.
+type Replay struct {
+	Settings SimulationSettings `json:"settings"`
+	Scenario Scenario           `json:"scenario"`
+	Events   []ReplayEvent      `json:"events"`
+	Ticks    int                `json:"ticks"`
+	Checksum uint64             `json:"checksum"` // Checksum of the world after all ticks, to check the replay is reproduced
+}
+
+// ReplayEvent is a single input to the world, applied before the step of its tick
+type ReplayEvent struct {
+	Tick          int            `json:"tick"`
+	Type          string         `json:"type"`
+	Seed          int64          `json:"seed,omitempty"`
+	EntityType    string         `json:"entity-type,omitempty"`
+	Position      pixel.Vec      `json:"position"`
+	Zoom          float64        `json:"zoom,omitempty"`
+	FishSettings  *FishSettings  `json:"fish-settings,omitempty"`
+	ScentSettings *ScentSettings `json:"scent-settings,omitempty"`
+	FluidSettings *FluidSettings `json:"fluid-settings,omitempty"`
+}
+
+// ApplyReplayEvent changes the world as described by an event. Camera events are ignored, as they do not affect the world.
+// Live input should also be applied through this, so that it behaves exactly the same when replayed.
+func ApplyReplayEvent(w *World, settings *SimulationSettings, ev ReplayEvent) error {
+	switch ev.Type {
+	case ReplayScatter:
+		rng := NewRNG(ev.Seed)
+		for _, e := range w.Entities.All() {
+			if !e.IsKinematic() {
+				e.ApplyImpulse(pixel.V(scatterImpulse, 0).Rotated(rng.Float64() * 3.14159 * 2))
+			}
+		}
+	case ReplaySplash:
+		w.Emit(Stimulus{StimulusSplash, ev.Position, splashIntensity, nil})
+	case ReplaySpawn:
+		e, err := SpawnEntity(ev.EntityType, ev.Position, settings, ev.Seed)
+		if err != nil {
+			return err
+		}
+		w.Entities.Add(e)
+	case ReplayFishSettings:
+		if ev.FishSettings != nil {
+			settings.FishSettings = *ev.FishSettings
+		}
+	case ReplayScentSettings:
+		if ev.ScentSettings != nil {
+			settings.Scent = *ev.ScentSettings
+		}
+	case ReplayFluidSettings:
+		if ev.FluidSettings != nil {
+			settings.Fluid = settings.Fluid.withLive(*ev.FluidSettings)
+		}
+	case ReplayCamera:
+	default:
+		return fmt.Errorf("unknown replay event %q", ev.Type)
+	}
+	return nil
+}
+
+// ReplayRecorder records the events of a live run
+type ReplayRecorder struct {
+	replay Replay
+}
+
+// NewReplayRecorder starts a recording of a world built from the settings and scenario
+func NewReplayRecorder(settings SimulationSettings, scenario Scenario) *ReplayRecorder {
+	return &ReplayRecorder{replay: Replay{Settings: settings, Scenario: scenario}}
+}
+
+// Record adds an event at the world's current tick
+func (r *ReplayRecorder) Record(w *World, ev ReplayEvent) {
+	ev.Tick = w.Tick
+	r.replay.Events = append(r.replay.Events, ev)
+}
+
+// Save writes the recording so far to a file, along with the checksum of the world as it is now
+func (r *ReplayRecorder) Save(w *World, path string) error {
+	r.replay.Ticks = w.Tick
+	r.replay.Checksum = w.Checksum()
+	data, err := json.Marshal(r.replay)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadReplay reads a replay file
+func LoadReplay(path string) (*Replay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	replay := &Replay{}
+	if err := json.Unmarshal(data, replay); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return replay, nil
+}
+
+// ReplayPlayer plays back a replay. It keeps snapshots of the world every so often while playing,
+// so that seeking only needs to re-simulate from the nearest snapshot before the target tick.
+type ReplayPlayer struct {
+	World    *World
+	Settings *SimulationSettings
+	Paused   bool
+	Speed    float64
+
+	replay           *Replay
+	nextEvent        int
+	keyframes        []*WorldSnapshot
+	keyframeSettings []SimulationSettings
+	keyframeInterval int
+	lastCamera       *ReplayEvent
+	pendingTicks     float64
+}
+
+// NewReplayPlayer builds the starting world of a replay, ready to play from the first tick
+func NewReplayPlayer(replay *Replay, workers, keyframeInterval int) (*ReplayPlayer, error) {
+	settings := replay.Settings
+	world, err := replay.Scenario.BuildWorld(&settings, workers)
+	if err != nil {
+		return nil, err
+	}
+	p := &ReplayPlayer{
+		World:            world,
+		Settings:         &settings,
+		Speed:            1,
+		replay:           replay,
+		keyframeInterval: keyframeInterval,
+	}
+	p.saveKeyframe()
+	return p, nil
+}
+
+// Finished returns whether every recorded tick has been played
+func (p *ReplayPlayer) Finished() bool {
+	return p.World.Tick >= p.replay.Ticks
+}
+
+// Ticks returns the length of the replay
+func (p *ReplayPlayer) Ticks() int {
+	return p.replay.Ticks
+}
+
+// Camera returns the last camera event played, or nil if there has not been one
+func (p *ReplayPlayer) Camera() *ReplayEvent {
+	return p.lastCamera
+}
+
+// StepTick applies the events of the current tick, then steps the world once
+func (p *ReplayPlayer) StepTick() error {
+	if p.Finished() {
+		return nil
+	}
+	for p.nextEvent < len(p.replay.Events) && p.replay.Events[p.nextEvent].Tick <= p.World.Tick {
+		ev := p.replay.Events[p.nextEvent]
+		if ev.Type == ReplayCamera {
+			p.lastCamera = &p.replay.Events[p.nextEvent]
+		}
+		if err := ApplyReplayEvent(p.World, p.Settings, ev); err != nil {
+			return err
+		}
+		p.nextEvent++
+	}
+	p.World.Step()
+	if p.World.Tick%p.keyframeInterval == 0 && p.World.Tick/p.keyframeInterval >= len(p.keyframes) {
+		p.saveKeyframe()
+	}
+	return nil
+}
+
+// Advance plays the replay for a frame lasting dt real seconds, at the current speed, unless paused.
+// Fractions of a tick are carried over to the next frame.
+func (p *ReplayPlayer) Advance(dt float64) error {
+	if p.Paused {
+		return nil
+	}
+	p.pendingTicks += dt / FixedPhysicsTimestep * p.Speed
+	for ; p.pendingTicks >= 1; p.pendingTicks-- {
+		if err := p.StepTick(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Seek jumps to a tick by restoring the nearest snapshot before it, and re-simulating the rest
+func (p *ReplayPlayer) Seek(tick int) error {
+	if tick < 0 {
+		tick = 0
+	}
+	if tick > p.replay.Ticks {
+		tick = p.replay.Ticks
+	}
+	k := tick / p.keyframeInterval
+	if k >= len(p.keyframes) {
+		k = len(p.keyframes) - 1
+	}
+	// Going forwards can carry on from where we are now
+	if tick < p.World.Tick {
+		p.World.Restore(p.keyframes[k])
+		*p.Settings = p.keyframeSettings[k]
+		p.nextEvent = 0
+		p.lastCamera = nil
+		for p.nextEvent < len(p.replay.Events) && p.replay.Events[p.nextEvent].Tick < p.World.Tick {
+			if p.replay.Events[p.nextEvent].Type == ReplayCamera {
+				p.lastCamera = &p.replay.Events[p.nextEvent]
+			}
+			p.nextEvent++
+		}
+	}
+	for p.World.Tick < tick {
+		if err := p.StepTick(); err != nil {
+			return err
+		}
+	}
+	p.pendingTicks = 0
+	return nil
+}
+
+// Verify plays the rest of the replay, and checks the world ends up the same as when it was recorded
+func (p *ReplayPlayer) Verify() error {
+	if err := p.Seek(p.replay.Ticks); err != nil {
+		return err
+	}
+	if sum := p.World.Checksum(); sum != p.replay.Checksum {
+		return fmt.Errorf("replay diverged: checksum after %d ticks is %x, expected %x", p.World.Tick, sum, p.replay.Checksum)
+	}
+	return nil
+}
+
+func (p *ReplayPlayer) saveKeyframe() {
+	p.keyframes = append(p.keyframes, p.World.Snapshot())
+	p.keyframeSettings = append(p.keyframeSettings, *p.Settings)
+}
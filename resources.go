@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"image/png"
 	"os"
 	"path"
@@ -9,30 +11,112 @@ import (
 	"github.com/gopxl/pixel"
 )
 
+// SpritesDir is the directory that all sprites and atlases are loaded from
+var SpritesDir = path.Join(".", "data", "sprites")
+
 var globalResPics map[string]pixel.Picture
+var globalResAtlases map[string]*SpriteAtlas
+
+// globalResVersion is incremented every time a resource is reloaded, so anything that caches resources knows to refresh
+var globalResVersion int
+
+// SpriteAtlas describes where named sprites are on a sprite sheet of square sprites, and how they are animated.
+// An atlas named "x" is loaded from x.json, and describes the picture loaded from x.png.
+type SpriteAtlas struct {
+	SpriteWidth    float64                     `json:"sprite-width"`
+	Sprites        map[string][2]float64       `json:"sprites"`
+	Animations     map[string][]string         `json:"animations"`
+	AnimationTimes map[string]float64          `json:"animation-times"`
+	OneShots       []string                    `json:"one-shots"`
+	Events         map[string]map[int][]string `json:"events"`
+}
 
 func init() {
-	// Load up all the GlobalResPics
+	loadResources()
+}
+
+// loadResources loads every sprite and atlas, unless they have already been loaded.
+// Entity definitions are checked against the atlases, so they may need them before this file's init has run.
+func loadResources() {
+	if globalResPics != nil {
+		return
+	}
 	globalResPics = make(map[string]pixel.Picture)
-	sp := path.Join(".", "data", "sprites")
-	entries, err := os.ReadDir(sp)
+	globalResAtlases = make(map[string]*SpriteAtlas)
+	entries, err := os.ReadDir(SpritesDir)
 	if err != nil {
-		panic("err")
+		panic(err)
 	}
 	for _, e := range entries {
 		if e.IsDir() {
 			continue
 		}
-		f, err := os.Open(path.Join(sp, e.Name()))
-		if err != nil {
+		if err := ReloadResource(path.Join(SpritesDir, e.Name())); err != nil {
 			panic(err)
 		}
-		img, err := png.Decode(f)
+	}
+}
+
+// ReloadResource (re)loads the sprite or atlas at the given path, replacing any existing resource with the same name.
+// If the file can not be loaded, the existing resource is kept.
+func ReloadResource(filePath string) error {
+	name := path.Base(filePath)
+	switch {
+	case strings.HasSuffix(name, ".png"):
+		pic, err := loadPicture(filePath)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		globalResPics[strings.TrimSuffix(name, ".png")] = pic
+	case strings.HasSuffix(name, ".json"):
+		atlas, err := loadAtlas(filePath)
+		if err != nil {
+			return err
+		}
+		globalResAtlases[strings.TrimSuffix(name, ".json")] = atlas
+	default:
+		return nil
+	}
+	globalResVersion++
+	return nil
+}
+
+func loadPicture(filePath string) (pixel.Picture, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filePath, err)
+	}
+	return pixel.PictureDataFromImage(img), nil
+}
+
+func loadAtlas(filePath string) (*SpriteAtlas, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	atlas := &SpriteAtlas{}
+	if err := json.Unmarshal(data, atlas); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filePath, err)
+	}
+	for anim, frames := range atlas.Animations {
+		if atlas.AnimationTimes[anim] <= 0 {
+			return nil, fmt.Errorf("animation %s in %s must have a positive time", anim, filePath)
+		}
+		if len(frames) == 0 {
+			return nil, fmt.Errorf("animation %s in %s has no frames", anim, filePath)
+		}
+		for _, f := range frames {
+			if _, ok := atlas.Sprites[f]; !ok {
+				return nil, fmt.Errorf("animation %s in %s uses unknown sprite %s", anim, filePath, f)
+			}
 		}
-		globalResPics[strings.TrimSuffix(e.Name(), ".png")] = pixel.PictureDataFromImage(img)
 	}
+	return atlas, nil
 }
 
 func GetSpritePicture(name string) pixel.Picture {
@@ -41,3 +125,17 @@ func GetSpritePicture(name string) pixel.Picture {
 	}
 	panic("sprite did not exist")
 }
+
+// hasSpriteAtlas returns whether there is both a picture and an atlas with the given name
+func hasSpriteAtlas(name string) bool {
+	_, hasPic := globalResPics[name]
+	_, hasAtlas := globalResAtlases[name]
+	return hasPic && hasAtlas
+}
+
+func GetSpriteAtlas(name string) *SpriteAtlas {
+	if atlas, ok := globalResAtlases[name]; ok {
+		return atlas
+	}
+	panic("atlas did not exist")
+}
@@ -0,0 +1,48 @@
+package main
+
+import "math"
+
+// RNG is a small deterministic random number generator (splitmix64).
+// It is a plain value, so copying it copies its state. This lets a cloned entity carry on with exactly the same
+// random numbers as the original, which keeps snapshots and replays deterministic.
+type RNG struct {
+	state uint64
+}
+
+// NewRNG creates a generator from a seed
+func NewRNG(seed int64) RNG {
+	return RNG{state: uint64(seed)}
+}
+
+// Uint64 returns a random 64 bit number
+func (r *RNG) Uint64() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 returns a random non-negative int64, useful for seeding other generators
+func (r *RNG) Int63() int64 {
+	return int64(r.Uint64() >> 1)
+}
+
+// Float64 returns a random number in [0, 1)
+func (r *RNG) Float64() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+// Intn returns a random number in [0, n). It panics if n is not positive.
+func (r *RNG) Intn(n int) int {
+	if n <= 0 {
+		panic("invalid argument to Intn")
+	}
+	return int(r.Uint64() % uint64(n))
+}
+
+// NormFloat64 returns a normally distributed number with a mean of 0 and a standard deviation of 1
+func (r *RNG) NormFloat64() float64 {
+	// Box-Muller, using 1 - Float64 so the logarithm is never of 0
+	return math.Sqrt(-2*math.Log(1-r.Float64())) * math.Cos(2*math.Pi*r.Float64())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gopxl/pixel"
+)
+
+// Scenario describes how to set up a world for an experiment
+type Scenario struct {
+	// Settings are applied on top of the settings file, so only the values that change need to be given
+	Settings json.RawMessage `json:"settings"`
+	Kelp     bool            `json:"kelp"`
+	Spawns   []ScenarioSpawn `json:"spawns"`
+}
+
+// ScenarioSpawn spawns a number of entities of one type at random water positions within a rectangle
+type ScenarioSpawn struct {
+	Type   string     `json:"type"`
+	Count  int        `json:"count"`
+	Min    [2]float64 `json:"min"`
+	Max    [2]float64 `json:"max"`
+	Genome string     `json:"genome"` // Optional genome file giving fish an evolved brain, only for the fish type
+}
+
+// DefaultScenario is the world that is created when running the simulation in a window
+var DefaultScenario = Scenario{
+	Kelp: true,
+	Spawns: []ScenarioSpawn{
+		{Type: "fish", Count: 500, Min: [2]float64{2, 245}, Max: [2]float64{502, 250}},
+	},
+}
+
+// maxSpawnAttempts is how many random positions are tried for each entity before giving up
+const maxSpawnAttempts = 100
+
+// LoadScenario reads a scenario file
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	if err := json.Unmarshal(data, scenario); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+// ApplySettings returns the base settings with the scenario's settings applied on top
+func (s *Scenario) ApplySettings(base SimulationSettings) (SimulationSettings, error) {
+	if len(s.Settings) == 0 {
+		return base, nil
+	}
+	if err := json.Unmarshal(s.Settings, &base); err != nil {
+		return base, fmt.Errorf("failed to apply scenario settings: %w", err)
+	}
+	if err := base.validate(); err != nil {
+		return base, fmt.Errorf("invalid scenario settings: %w", err)
+	}
+	return base, nil
+}
+
+// BuildWorld generates the map and spawns everything in the scenario. The settings must live as long as the world.
+// The same settings (including the map seed) always build the same world.
+func (s *Scenario) BuildWorld(settings *SimulationSettings, workers int) (*World, error) {
+	world := NewWorldWithSettings(NewGeneratedMap(settings.MapGenerationParams), settings, workers)
+	if s.Kelp {
+		ScatterKelp(world, settings.FloraSettings, settings.MapGenerationParams.Seed)
+	}
+	rng := NewRNG(settings.MapGenerationParams.Seed)
+	for _, spawn := range s.Spawns {
+		var genome *Genome
+		if spawn.Genome != "" {
+			if spawn.Type != "fish" {
+				return nil, fmt.Errorf("only fish can be given a genome, not %s", spawn.Type)
+			}
+			var err error
+			if genome, err = LoadGenome(spawn.Genome); err != nil {
+				return nil, err
+			}
+		}
+		min, max := pixel.V(spawn.Min[0], spawn.Min[1]), pixel.V(spawn.Max[0], spawn.Max[1])
+		for i := 0; i < spawn.Count; i++ {
+			pos, ok := randomWaterPosition(world.Map, &rng, min, max)
+			if !ok {
+				return nil, fmt.Errorf("could not find water to spawn %s in", spawn.Type)
+			}
+			var e Entity
+			var err error
+			if genome != nil {
+				e, err = NewNeuralFish(pos, &settings.FishSettings, genome.Net, rng.Int63())
+			} else {
+				e, err = SpawnEntity(spawn.Type, pos, settings, rng.Int63())
+			}
+			if err != nil {
+				return nil, err
+			}
+			world.Entities.Add(e)
+		}
+	}
+	return world, nil
+}
+
+// randomWaterPosition picks a random position in the rectangle that is in a water texel
+func randomWaterPosition(m *Map, rng *RNG, min, max pixel.Vec) (pixel.Vec, bool) {
+	for i := 0; i < maxSpawnAttempts; i++ {
+		pos := pixel.V(min.X+rng.Float64()*(max.X-min.X), min.Y+rng.Float64()*(max.Y-min.Y))
+		if m.IsWaterAt(pos) {
+			return pos, true
+		}
+	}
+	return pixel.ZV, false
+}
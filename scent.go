@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/gopxl/pixel"
+)
+
+// ScentChannel is one kind of scent carried by the water
+type ScentChannel int
+
+const (
+	ScentFood      ScentChannel = iota // Given off by food
+	ScentBlood                         // Spilled when something is caught
+	ScentPheromone                     // Laid by creatures as a trail for others to follow
+	numScentChannels
+)
+
+var scentChannelNames = [numScentChannels]string{"food", "blood", "pheromone"}
+
+func (c ScentChannel) String() string { return scentChannelNames[c] }
+
+// UnmarshalJSON reads a channel from its name, so definitions can refer to channels by name
+func (c *ScentChannel) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	i := slices.Index(scentChannelNames[:], name)
+	if i < 0 {
+		return fmt.Errorf("unknown scent channel %q", name)
+	}
+	*c = ScentChannel(i)
+	return nil
+}
+
+func (c ScentChannel) MarshalJSON() ([]byte, error) { return json.Marshal(c.String()) }
+
+// ScentChannelSettings control how one channel of scent spreads and fades
+type ScentChannelSettings struct {
+	Diffusion float64 `json:"diffusion"` // Rate scent spreads into neighbouring water texels, per second
+	Decay     float64 `json:"decay"`     // Fraction of the scent that fades away per second
+}
+
+// ScentSettings control each channel of the scent field. They can be changed while the simulation is running.
+type ScentSettings struct {
+	Food      ScentChannelSettings `json:"food"`
+	Blood     ScentChannelSettings `json:"blood"`
+	Pheromone ScentChannelSettings `json:"pheromone"`
+}
+
+func (s *ScentSettings) channel(c ScentChannel) ScentChannelSettings {
+	switch c {
+	case ScentFood:
+		return s.Food
+	case ScentBlood:
+		return s.Blood
+	}
+	return s.Pheromone
+}
+
+// scentMinimum is the concentration below which a channel is treated as empty. Once every texel of a channel
+// is below it, the channel is cleared and no longer updated until more is deposited.
+const scentMinimum = 1e-4
+
+// ScentDeposit is an amount of scent added to the texel containing a point
+type ScentDeposit struct {
+	Channel ScentChannel
+	Pos     pixel.Vec
+	Amount  float64
+}
+
+// ScentDepositor is an optional interface for entities that leave scent. The world collects the deposits after every
+// entity has finished its logic, so they can be smelt on the next step.
+type ScentDepositor interface {
+	// TakeDeposits appends the scent deposited since it was last called to dst, and forgets it
+	TakeDeposits(dst []ScentDeposit) []ScentDeposit
+}
+
+// scentBuffer holds the scent an entity deposits during its logic, until the world collects it.
+// It can be embedded in an entity to implement ScentDepositor.
+type scentBuffer struct {
+	deposited []ScentDeposit
+}
+
+func (b *scentBuffer) deposit(d ScentDeposit) {
+	b.deposited = append(b.deposited, d)
+}
+
+func (b *scentBuffer) TakeDeposits(dst []ScentDeposit) []ScentDeposit {
+	dst = append(dst, b.deposited...)
+	b.deposited = b.deposited[:0]
+	return dst
+}
+
+// ScentField is the concentration of each channel of scent in every texel of the map. Every step the scent spreads
+// to neighbouring texels and fades away, but only through water, so rock walls block it and caves hold it in.
+// Entities smell it by sampling the concentration and its gradient where they are, so they can follow a trail
+// without knowing where it came from.
+type ScentField struct {
+	Settings *ScentSettings
+
+	width, height int
+	water         []bool                      // Whether each texel is water, indexed by tx*height+ty
+	values        [numScentChannels][]float64 // Nil for channels with no scent in them
+	columnMax     [numScentChannels][]float64 // Strongest scent in each column, so empty columns can be skipped
+	next          []float64
+	nextColumnMax []float64
+}
+
+// NewScentField creates an empty field covering the texels of a map. The settings are shared, so changing them
+// affects the field while it is running.
+func NewScentField(m *Map, settings *ScentSettings) *ScentField {
+	width, height := len(m.texels), len(m.texels[0])
+	water := make([]bool, width*height)
+	for tx := 0; tx < width; tx++ {
+		for ty := 0; ty < height; ty++ {
+			water[tx*height+ty] = m.IsWater(tx, ty)
+		}
+	}
+	return &ScentField{Settings: settings, width: width, height: height, water: water}
+}
+
+// Bounds returns the area of the world covered by the field's texels
+func (f *ScentField) Bounds() pixel.Rect {
+	return pixel.R(-0.5, -0.5, float64(f.width)-0.5, float64(f.height)-0.5)
+}
+
+// index returns where a texel is stored, and whether it is water
+func (f *ScentField) index(tx, ty int) (int, bool) {
+	if tx < 0 || ty < 0 || tx >= f.width || ty >= f.height {
+		return 0, false
+	}
+	i := tx*f.height + ty
+	return i, f.water[i]
+}
+
+// Deposit adds scent to the texel containing a point. Scent deposited in a solid texel is lost.
+// It must not be called while the world is stepping.
+func (f *ScentField) Deposit(d ScentDeposit) {
+	i, ok := f.index(int(math.Round(d.Pos.X)), int(math.Round(d.Pos.Y)))
+	if !ok || d.Amount <= 0 {
+		return
+	}
+	c := d.Channel
+	if f.values[c] == nil {
+		f.values[c] = make([]float64, len(f.water))
+		f.columnMax[c] = make([]float64, f.width)
+	}
+	f.values[c][i] += d.Amount
+	tx := i / f.height
+	f.columnMax[c][tx] = math.Max(f.columnMax[c][tx], f.values[c][i])
+}
+
+// At returns the concentration of a channel at a point, interpolated between the centres of the water texels
+// around it. Solid texels are left out rather than counted as empty, so scent does not seem to fade near walls.
+func (f *ScentField) At(c ScentChannel, pos pixel.Vec) float64 {
+	values := f.values[c]
+	if values == nil {
+		return 0
+	}
+	x0, y0 := math.Floor(pos.X), math.Floor(pos.Y)
+	wx := [2]float64{1 - (pos.X - x0), pos.X - x0}
+	wy := [2]float64{1 - (pos.Y - y0), pos.Y - y0}
+	sum, weight := 0.0, 0.0
+	for dx := 0; dx < 2; dx++ {
+		for dy := 0; dy < 2; dy++ {
+			i, ok := f.index(int(x0)+dx, int(y0)+dy)
+			if !ok {
+				continue
+			}
+			w := wx[dx] * wy[dy]
+			sum += w * values[i]
+			weight += w
+		}
+	}
+	if weight == 0 {
+		return 0
+	}
+	return sum / weight
+}
+
+// Gradient returns which way, and how steeply, the concentration of a channel rises at a point
+func (f *ScentField) Gradient(c ScentChannel, pos pixel.Vec) pixel.Vec {
+	if f.values[c] == nil {
+		return pixel.ZV
+	}
+	const h = 0.5
+	dx := f.At(c, pos.Add(pixel.V(h, 0))) - f.At(c, pos.Sub(pixel.V(h, 0)))
+	dy := f.At(c, pos.Add(pixel.V(0, h))) - f.At(c, pos.Sub(pixel.V(0, h)))
+	return pixel.V(dx, dy).Scaled(1 / (2 * h))
+}
+
+// Active returns whether a channel has any scent in it
+func (f *ScentField) Active(c ScentChannel) bool {
+	return f.values[c] != nil
+}
+
+// Step adds the deposits in order, then spreads and fades every channel with scent in it by one fixed timestep
+func (f *ScentField) Step(deposits []ScentDeposit, workers int) {
+	for _, d := range deposits {
+		f.Deposit(d)
+	}
+	for c := range f.values {
+		if f.values[c] != nil {
+			f.diffuse(ScentChannel(c), workers)
+		}
+	}
+}
+
+// diffuse moves scent between every pair of neighbouring water texels in proportion to their difference,
+// then fades it all. Each texel only depends on the values from the last step, so columns are updated in parallel.
+// Columns with no scent in or beside them are left empty without being updated.
+func (f *ScentField) diffuse(c ScentChannel, workers int) {
+	settings := f.Settings.channel(c)
+	// Moving more than a quarter of the difference to each of four neighbours would overshoot and oscillate
+	rate := math.Min(settings.Diffusion*FixedPhysicsTimestep, 0.25)
+	keep := math.Max(1-settings.Decay*FixedPhysicsTimestep, 0)
+	if f.next == nil {
+		f.next = make([]float64, len(f.water))
+		f.nextColumnMax = make([]float64, f.width)
+	}
+	values, next, water, width, height := f.values[c], f.next, f.water, f.width, f.height
+	lastMax, nextMax := f.columnMax[c], f.nextColumnMax
+	ParallelFor(width, workers, func(start, end int) {
+		for tx := start; tx < end; tx++ {
+			if lastMax[tx] < scentMinimum && (tx == 0 || lastMax[tx-1] < scentMinimum) &&
+				(tx == width-1 || lastMax[tx+1] < scentMinimum) {
+				clear(next[tx*height : (tx+1)*height])
+				nextMax[tx] = 0
+				continue
+			}
+			columnMax := 0.0
+			for ty := 0; ty < height; ty++ {
+				i := tx*height + ty
+				if !water[i] {
+					next[i] = 0
+					continue
+				}
+				v := values[i]
+				flow := 0.0
+				if ty > 0 && water[i-1] {
+					flow += values[i-1] - v
+				}
+				if ty < height-1 && water[i+1] {
+					flow += values[i+1] - v
+				}
+				if tx > 0 && water[i-height] {
+					flow += values[i-height] - v
+				}
+				if tx < width-1 && water[i+height] {
+					flow += values[i+height] - v
+				}
+				next[i] = (v + rate*flow) * keep
+				columnMax = math.Max(columnMax, next[i])
+			}
+			nextMax[tx] = columnMax
+		}
+	})
+	f.values[c], f.next = next, values
+	f.columnMax[c], f.nextColumnMax = nextMax, lastMax
+	if slices.Max(nextMax) < scentMinimum {
+		f.values[c], f.columnMax[c] = nil, nil
+	}
+}
+
+// Clone copies the field, so it can be restored later. The map's texels are shared, as they do not change.
+func (f *ScentField) Clone() *ScentField {
+	clone := *f
+	for c, values := range f.values {
+		clone.values[c] = slices.Clone(values)
+		clone.columnMax[c] = slices.Clone(f.columnMax[c])
+	}
+	clone.next, clone.nextColumnMax = nil, nil
+	return &clone
+}
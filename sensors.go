@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gopxl/pixel"
+)
+
+// Senses describe what an entity can perceive. Vision sees entities and terrain within a cone in front of the entity,
+// as long as no solid texels are in the way, and reaches less far the darker it is. The lateral line feels anything
+// moving close by, in any direction and in any light. Hearing picks up stimuli made by other entities.
+type Senses struct {
+	VisionRange  float64 `json:"vision-range"`  // How far the entity can see in full light
+	FieldOfView  float64 `json:"field-of-view"` // Angle of the vision cone in degrees, centred on the heading
+	DarkVision   float64 `json:"dark-vision"`   // Fraction of the vision range kept in complete darkness
+	TerrainRays  int     `json:"terrain-rays"`  // Number of rays cast across the field of view to see the terrain
+	LateralRange float64 `json:"lateral-range"` // How far the lateral line can feel movement
+	LateralSpeed float64 `json:"lateral-speed"` // How fast something must move relative to the entity to be felt
+	Hearing      float64 `json:"hearing"`       // Quietest stimulus that can be heard, or 0 to hear nothing
+}
+
+var DefSenses = Senses{
+	VisionRange:  8,
+	FieldOfView:  270,
+	DarkVision:   0.2,
+	TerrainRays:  5,
+	LateralRange: 2,
+	LateralSpeed: 0.5,
+	Hearing:      0.5,
+}
+
+// Percept is another entity that was perceived
+type Percept struct {
+	Entity   Entity
+	Offset   pixel.Vec // From the perceiving entity to the other entity
+	Distance float64
+	Seen     bool // Whether it was seen, rather than only felt
+	Felt     bool // Whether it was felt by the lateral line
+}
+
+// TerrainPercept is one ray of vision cast against the map
+type TerrainPercept struct {
+	Dir      pixel.Vec
+	Distance float64
+	Hit      bool
+}
+
+// Perception is everything an entity perceived during one step. It refers to other entities, so it must only be
+// used during the step it was sensed in, or while the world is not stepping.
+type Perception struct {
+	Origin      pixel.Vec
+	Heading     float64
+	VisionRange float64 // How far the entity could see, after the light was taken into account
+	Senses      *Senses
+	Entities    []Percept
+	Terrain     []TerrainPercept
+	Heard       []HeardStimulus
+}
+
+// Sense fills the perception with what an entity facing heading perceives. Its slices are reused between steps.
+// It only reads positions and velocities, so it is safe to call while other entities are stepping.
+func (s *Senses) Sense(self Entity, heading float64, w *World, p *Perception) {
+	pos := self.Position()
+	light := w.Map.GetLightAt(pos)
+	p.Origin, p.Heading, p.Senses = pos, heading, s
+	p.VisionRange = s.VisionRange * (s.DarkVision + (1-s.DarkVision)*light)
+	p.Entities, p.Terrain = p.Entities[:0], p.Terrain[:0]
+	s.hear(self, w, p)
+
+	halfFOV := s.FieldOfView * math.Pi / 360
+	for i := 0; i < s.TerrainRays; i++ {
+		angle := heading
+		if s.TerrainRays > 1 {
+			angle += halfFOV * (2*float64(i)/float64(s.TerrainRays-1) - 1)
+		}
+		dir := pixel.Unit(angle)
+		hit, dist := w.Map.Raycast(pos, dir, p.VisionRange)
+		p.Terrain = append(p.Terrain, TerrainPercept{dir, dist, hit})
+	}
+
+	all := w.Entities.All()
+	w.Grid().Query(pos, math.Max(p.VisionRange, s.LateralRange), func(i int) {
+		other := all[i]
+		if other == self {
+			return
+		}
+		offset := other.Position().Sub(pos)
+		dist := offset.Len()
+		felt := dist < s.LateralRange && other.Velocity().Sub(self.Velocity()).Len() > s.LateralSpeed
+		seen := dist < p.VisionRange && math.Abs(math.Remainder(offset.Angle()-heading, 2*math.Pi)) <= halfFOV
+		if seen {
+			hit, _ := w.Map.Raycast(pos, offset, dist)
+			seen = !hit
+		}
+		if seen || felt {
+			p.Entities = append(p.Entities, Percept{other, offset, dist, seen, felt})
+		}
+	})
+}
+
+// Nearest returns the closest perceived entity with a tag within radius, if there is one
+func (p *Perception) Nearest(tag string, radius float64) (Percept, bool) {
+	var nearest Percept
+	found := false
+	for _, pc := range p.Entities {
+		if pc.Distance < radius && (!found || pc.Distance < nearest.Distance) && HasTag(pc.Entity, tag) {
+			nearest, found = pc, true
+		}
+	}
+	return nearest, found
+}
+
+// WithTag calls fn for every perceived entity with a tag within radius
+func (p *Perception) WithTag(tag string, radius float64, fn func(Percept)) {
+	for _, pc := range p.Entities {
+		if pc.Distance < radius && HasTag(pc.Entity, tag) {
+			fn(pc)
+		}
+	}
+}
+
+// Clear forgets everything perceived, so a cloned entity does not refer to the entities of the original
+func (p *Perception) Clear() {
+	*p = Perception{Senses: p.Senses}
+}
+
+// DebugFields summarises the perception for the inspector
+func (p *Perception) DebugFields() []DebugField {
+	seen, felt := 0, 0
+	for _, pc := range p.Entities {
+		if pc.Seen {
+			seen++
+		}
+		if pc.Felt {
+			felt++
+		}
+	}
+	return []DebugField{
+		{"vision", fmt.Sprintf("%.1fm, sees %d", p.VisionRange, seen)},
+		{"lateral line", fmt.Sprintf("feels %d", felt)},
+		{"hearing", fmt.Sprintf("hears %d", len(p.Heard))},
+	}
+}
+
+// Perceiver is an optional interface for entities that sense their surroundings, so what they perceive can be shown
+type Perceiver interface {
+	Perception() *Perception
+}
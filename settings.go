@@ -1,5 +1,15 @@
 package main
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DefSettingsPath is where the settings file is loaded from, and watched for changes
+const DefSettingsPath = "data/settings.json"
+
 var DefSimSettings = SimulationSettings{
 	MapGenerationParams: MapGenerationParams{
 		Length:       512,
@@ -10,37 +20,241 @@ var DefSimSettings = SimulationSettings{
 		CaveAR:       2,
 		CaveThresh:   0.1,
 		Seed:         -1,
+		Surface: SurfaceParams{
+			Level:      232,
+			WaveHeight: 1,
+			WaveLength: 40,
+			WaveSpeed:  3,
+		},
+		Environment: EnvironmentParams{
+			SurfaceTemperature: 22,
+			DeepTemperature:    4,
+			Thermocline:        0.3,
+			Vents:              3,
+			VentTemperature:    40,
+			VentRadius:         10,
+			SurfaceSalinity:    33,
+			DeepSalinity:       35,
+			SalinityNoise:      1,
+			SurfaceOxygen:      8,
+			DeepOxygen:         1,
+			OxygenFalloff:      80,
+		},
+	},
+	ConstraintIterations: 8,
+	CurrentStrength:      0.5,
+	Air: AirSettings{
+		Gravity:         9.81,
+		SplashSpeed:     2,
+		SplashDamping:   0.5,
+		SplashIntensity: 0.5,
+	},
+	Collision: CollisionSettings{
+		SweepSpeed: 15,
+	},
+	Fluid: FluidSettings{
+		Enabled:    false,
+		CellSize:   4,
+		Interval:   4,
+		Viscosity:  0.5,
+		Decay:      0.2,
+		Iterations: 20,
+		Coupling:   2,
+	},
+	FloraSettings: FloraSettings{
+		KelpDensity:   0.08,
+		MinSegments:   4,
+		MaxSegments:   14,
+		SegmentRadius: 0.3,
+		SegmentMass:   0.2,
+		Buoyancy:      1.5,
+		Drag:          0.5,
+		MaxBend:       30,
+	},
+	FishSettings: FishSettings{
+		Thrust:             5,
+		Drag:               1,
+		TurnSpeed:          6.283,
+		DirChangeInterval:  5,
+		SwimAnimationSpeed: 0.5,
+		NeighbourRadius:    3,
+		CoverSlowdown:      0.5,
+		EnergyUse:          0.02,
+		Senses:             DefSenses,
+		Tolerances:         DefTolerances,
+	},
+	PredatorSettings: PredatorSettings{
+		Thrust:            12,
+		Drag:              1.5,
+		TurnSpeed:         3,
+		DirChangeInterval: 8,
+		Senses: Senses{
+			VisionRange:  10,
+			FieldOfView:  200,
+			DarkVision:   0.3,
+			LateralRange: 3,
+			LateralSpeed: 0.5,
+			Hearing:      0.5,
+		},
+		SplashIntensity: 6,
+		BloodScent:      0.01,
+	},
+	Scent: ScentSettings{
+		Food:      ScentChannelSettings{Diffusion: 2, Decay: 0.05},
+		Blood:     ScentChannelSettings{Diffusion: 4, Decay: 0.1},
+		Pheromone: ScentChannelSettings{Diffusion: 0.5, Decay: 0.2},
 	},
 }
 
 var DefUserSettings = UserSettings{
 	CameraSettings: CameraSettings{
-		ZoomSpeed: 4.0,
-		MoveSpeed: 500,
+		ZoomSpeed:         4.0,
+		MoveSpeed:         500,
+		ScrollZoomSpeed:   1.2,
+		FollowSmoothing:   0.2,
+		MinPixelsPerMeter: 2,
+		MaxPixelsPerMeter: 200,
+		ClampToBounds:     true,
 	},
+	Bindings: DefaultBindings,
 }
 
 // MapGenerationParams are the parameters used to generate a new environment
 type MapGenerationParams struct {
-	Length       int     `json:"length"`
-	Height       int     `json:"height"`
-	PerlinWidth  float64 `json:"perlin-width"`
-	PerlinHeight float64 `json:"perlin-height"`
-	CaveWidth    float64 `json:"cave-width"`
-	CaveAR       float64 `json:"cave-height"`
-	CaveThresh   float64 `json:"cave-thresh"`
-	Seed         int64   `json:"seed"`
+	Length       int               `json:"length"`
+	Height       int               `json:"height"`
+	PerlinWidth  float64           `json:"perlin-width"`
+	PerlinHeight float64           `json:"perlin-height"`
+	CaveWidth    float64           `json:"cave-width"`
+	CaveAR       float64           `json:"cave-height"`
+	CaveThresh   float64           `json:"cave-thresh"`
+	Seed         int64             `json:"seed"`
+	Surface      SurfaceParams     `json:"surface"`     // Where the sea surface is, and the waves along it
+	Environment  EnvironmentParams `json:"environment"` // How the temperature, salinity and oxygen of the water are generated
+}
+
+// FishSettings are the tunable parameters shared by all fish. They can be changed while the simulation is running.
+type FishSettings struct {
+	Thrust             float64    `json:"thrust"`
+	Drag               float64    `json:"drag"`
+	TurnSpeed          float64    `json:"turn-speed"`
+	DirChangeInterval  float64    `json:"dir-change-interval"`
+	SwimAnimationSpeed float64    `json:"swim-animation-speed"` // Animation speed per unit of velocity
+	NeighbourRadius    float64    `json:"neighbour-radius"`     // Distance within which other fish are neighbours
+	CoverSlowdown      float64    `json:"cover-slowdown"`       // How much fish slow down to hide when fully in cover, between 0 and 1
+	EnergyUse          float64    `json:"energy-use"`           // Energy used per second swimming at full thrust, out of a full store of 1
+	Senses             Senses     `json:"senses"`               // What fish with an evolved brain can perceive
+	Tolerances         Tolerances `json:"tolerances"`           // Conditions fish are comfortable in, outside of which they use more energy
+}
+
+// PredatorSettings are the tunable parameters shared by all predators
+type PredatorSettings struct {
+	Thrust            float64 `json:"thrust"`
+	Drag              float64 `json:"drag"`
+	TurnSpeed         float64 `json:"turn-speed"`
+	DirChangeInterval float64 `json:"dir-change-interval"`
+	Senses            Senses  `json:"senses"`           // What predators can perceive, to find fish to chase
+	SplashIntensity   float64 `json:"splash-intensity"` // How loud the splash is when a predator starts a chase
+	BloodScent        float64 `json:"blood-scent"`      // Weakest scent of blood a predator follows when it has nothing to chase
+}
+
+// FloraSettings control how plants are scattered over the map, and how they move
+type FloraSettings struct {
+	KelpDensity   float64 `json:"kelp-density"` // Chance of each sand surface texel growing a strand of kelp
+	MinSegments   int     `json:"min-segments"`
+	MaxSegments   int     `json:"max-segments"`
+	SegmentRadius float64 `json:"segment-radius"`
+	SegmentMass   float64 `json:"segment-mass"`
+	Buoyancy      float64 `json:"buoyancy"`
+	Drag          float64 `json:"drag"`
+	MaxBend       float64 `json:"max-bend"` // Maximum bend between segments in degrees
+}
+
+// validate checks that kelp can be grown with the settings
+func (s *FloraSettings) validate() error {
+	if s.MinSegments < 1 {
+		return fmt.Errorf("flora min-segments must be at least 1, not %d", s.MinSegments)
+	}
+	if s.MaxSegments < s.MinSegments {
+		return fmt.Errorf("flora max-segments (%d) must not be less than min-segments (%d)", s.MaxSegments, s.MinSegments)
+	}
+	if s.SegmentRadius <= 0 || s.SegmentMass <= 0 {
+		return errors.New("flora segment-radius and segment-mass must be positive")
+	}
+	return nil
 }
 
 type SimulationSettings struct {
-	MapGenerationParams MapGenerationParams `json:"map-gen"`
+	MapGenerationParams  MapGenerationParams `json:"map-gen"`
+	Workers              int                 `json:"workers"`               // Number of goroutines to step the world with, 0 for one per CPU
+	ConstraintIterations int                 `json:"constraint-iterations"` // Number of times constraints are solved each step
+	CurrentStrength      float64             `json:"current-strength"`      // Speed of the swaying ocean current
+	Air                  AirSettings         `json:"air"`
+	Collision            CollisionSettings   `json:"collision"`
+	FloraSettings        FloraSettings       `json:"flora"`
+	FishSettings         FishSettings        `json:"fish"`
+	PredatorSettings     PredatorSettings    `json:"predator"`
+	Scent                ScentSettings       `json:"scent"`
+	Fluid                FluidSettings       `json:"fluid"` // Simulating the water, so entities stir up currents as they swim
 }
 
 type CameraSettings struct {
-	ZoomSpeed float64 `json:"zoom-speed"`
-	MoveSpeed float64 `json:"move-speed"`
+	ZoomSpeed         float64 `json:"zoom-speed"`
+	MoveSpeed         float64 `json:"move-speed"`
+	ScrollZoomSpeed   float64 `json:"scroll-zoom-speed"` // Zoom multiplier for each notch of the scroll wheel
+	FollowSmoothing   float64 `json:"follow-smoothing"`  // Time in seconds for the camera to catch up with a target, 0 to snap
+	MinPixelsPerMeter float64 `json:"min-pixels-per-meter"`
+	MaxPixelsPerMeter float64 `json:"max-pixels-per-meter"`
+	ClampToBounds     bool    `json:"clamp-to-bounds"`
 }
 
 type UserSettings struct {
 	CameraSettings CameraSettings `json:"camera"`
+	Bindings       InputBindings  `json:"bindings"` // Any actions not in the file keep their default bindings
+}
+
+// SettingsFile is the layout of the settings file on disk
+type SettingsFile struct {
+	SimulationSettings SimulationSettings `json:"simulation"`
+	UserSettings       UserSettings       `json:"user"`
+}
+
+// defaultSettingsFile returns the default settings, with their own copy of anything that would otherwise be shared
+// with the defaults, so callers can change them freely
+func defaultSettingsFile() SettingsFile {
+	settings := SettingsFile{
+		SimulationSettings: DefSimSettings,
+		UserSettings:       DefUserSettings,
+	}
+	// Bindings from the file are merged into the defaults, so they must not share the default map
+	settings.UserSettings.Bindings = DefUserSettings.Bindings.Clone()
+	return settings
+}
+
+// LoadSettings reads the settings file at path. Any values missing from the file are left as the defaults.
+// If the file can not be read, the defaults are returned with the error.
+func LoadSettings(path string) (SimulationSettings, UserSettings, error) {
+	settings := defaultSettingsFile()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return settings.SimulationSettings, settings.UserSettings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		defaults := defaultSettingsFile()
+		return defaults.SimulationSettings, defaults.UserSettings, err
+	}
+	if err := settings.SimulationSettings.validate(); err != nil {
+		defaults := defaultSettingsFile()
+		return defaults.SimulationSettings, defaults.UserSettings, fmt.Errorf("invalid settings in %s: %w", path, err)
+	}
+	return settings.SimulationSettings, settings.UserSettings, nil
+}
+
+// validate checks settings that would otherwise crash the simulation
+func (s *SimulationSettings) validate() error {
+	return errors.Join(
+		s.MapGenerationParams.Surface.validate(),
+		s.MapGenerationParams.Environment.validate(),
+		s.FloraSettings.validate(),
+	)
 }
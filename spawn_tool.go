@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/imdraw"
+	"github.com/gopxl/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// spawnSprayInterval is the time in seconds between each placement while the place button is held
+const spawnSprayInterval = 0.1
+
+// SpawnTool places new entities at the mouse, choosing their type from a palette of every registered entity type.
+// A click places a group of entities, and holding the button down sprays more as the mouse moves.
+type SpawnTool struct {
+	Enabled  bool
+	Count    int // Number of entities placed at a time
+	types    []string
+	selected int
+	rng      RNG
+	sprayT   float64
+	txt      *text.Text
+	imd      *imdraw.IMDraw
+}
+
+// NewSpawnTool creates a disabled spawn tool placing one entity at a time, with its randomness coming from seed
+func NewSpawnTool(seed int64) *SpawnTool {
+	return &SpawnTool{
+		Count: 1,
+		types: EntityTypeNames(),
+		rng:   NewRNG(seed),
+		txt:   text.New(pixel.ZV, globalTextAtlas),
+		imd:   imdraw.New(nil),
+	}
+}
+
+// Selected returns the name of the entity type that will be placed
+func (t *SpawnTool) Selected() string {
+	return t.types[t.selected]
+}
+
+// Update reads the spawn tool actions, and returns a spawn event for every entity placed this frame.
+// Positions inside solid texels are refused, and the number refused is returned alongside the events.
+// dt is the real time since the last update.
+func (t *SpawnTool) Update(input *InputMap, camera *Camera, m *Map, dt float64) ([]ReplayEvent, int) {
+	if input.JustPressed(ActionSpawnTool) {
+		t.Enabled = !t.Enabled
+	}
+	if !t.Enabled {
+		return nil, 0
+	}
+	if input.JustPressed(ActionSpawnNext) {
+		t.selected = (t.selected + 1) % len(t.types)
+	}
+	if input.JustPressed(ActionSpawnPrev) {
+		t.selected = (t.selected + len(t.types) - 1) % len(t.types)
+	}
+	if input.Repeated(ActionSpawnMore) {
+		t.Count++
+	}
+	if input.Repeated(ActionSpawnLess) && t.Count > 1 {
+		t.Count--
+	}
+
+	// Place straight away on a click, then keep spraying while held
+	place := false
+	if input.JustPressed(ActionSpawnPlace) {
+		place = true
+		t.sprayT = 0
+	} else if input.Pressed(ActionSpawnPlace) {
+		t.sprayT += dt
+		if t.sprayT >= spawnSprayInterval {
+			place = true
+			t.sprayT -= spawnSprayInterval
+		}
+	}
+	if !place {
+		return nil, 0
+	}
+
+	var events []ReplayEvent
+	refused := 0
+	centre := camera.ScreenToWorld(input.MousePosition())
+	for i := 0; i < t.Count; i++ {
+		pos := centre
+		if t.Count > 1 {
+			// Spread groups out over a circle big enough to fit them all
+			spread := 0.5 * math.Sqrt(float64(t.Count))
+			pos = pos.Add(pixel.V(spread*math.Sqrt(t.rng.Float64()), 0).Rotated(t.rng.Float64() * 2 * math.Pi))
+		}
+		if m.IsSolidAt(pos) {
+			refused++
+			continue
+		}
+		events = append(events, ReplayEvent{Type: ReplaySpawn, EntityType: t.Selected(), Position: pos, Seed: t.rng.Int63()})
+	}
+	return events, refused
+}
+
+// Render draws the palette of entity types on the left of the rect while the tool is enabled
+func (t *SpawnTool) Render(target pixel.Target, rect pixel.Rect) {
+	if !t.Enabled {
+		return
+	}
+	t.txt.Clear()
+	t.txt.Color = colornames.White
+	fmt.Fprintf(t.txt, "spawn x%d\n", t.Count)
+	for i, name := range t.types {
+		if i == t.selected {
+			t.txt.Color = colornames.Yellow
+			fmt.Fprintf(t.txt, "> %s\n", name)
+		} else {
+			t.txt.Color = colornames.Lightgray
+			fmt.Fprintf(t.txt, "  %s\n", name)
+		}
+	}
+	panelSize := t.txt.Bounds().Size().Add(pixel.V(10, 10))
+	panelMin := pixel.V(rect.Min.X, rect.Center().Y-panelSize.Y/2)
+
+	t.imd.Clear()
+	t.imd.Color = pixel.RGBA{A: 0.6}
+	t.imd.Push(panelMin, panelMin.Add(panelSize))
+	t.imd.Rectangle(0)
+	t.imd.Draw(target)
+
+	t.txt.Draw(target, pixel.IM.Moved(panelMin.Add(pixel.V(5, panelSize.Y-5-globalTextAtlas.Ascent()))))
+}
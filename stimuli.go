@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"slices"
+
+	"github.com/gopxl/pixel"
+)
+
+// Kinds of stimulus that entities make
+const (
+	StimulusAlarm   = "alarm"   // A prey animal has noticed danger
+	StimulusFeeding = "feeding" // Something is eating
+	StimulusSplash  = "splash"  // A sudden large movement, such as a predator lunging
+)
+
+// stimulusSolidDamping is the fraction of a stimulus' intensity that passes through each solid texel in the way,
+// so a few texels of rock block it completely
+const stimulusSolidDamping = 0.25
+
+// Stimulus is a sound or pressure wave made at a point. It can be heard for one step after it is made,
+// more quietly the further away the listener is and the more solid texels are in the way.
+type Stimulus struct {
+	Kind      string
+	Source    pixel.Vec
+	Intensity float64 // How loud it is 1m from the source
+	Emitter   Entity  // Entity that made it, which does not hear itself. Nil if it came from outside the world.
+}
+
+// IntensityAt returns how loud the stimulus is at a position. It spreads out over the water, so it gets quieter
+// with distance, and is damped by every solid texel in the way. Anything quieter than threshold is returned as 0
+// without checking the map.
+func (s Stimulus) IntensityAt(m *Map, pos pixel.Vec, threshold float64) float64 {
+	intensity := s.Intensity / math.Max(pos.Sub(s.Source).Len(), 1)
+	if intensity < threshold {
+		return 0
+	}
+	intensity *= math.Pow(stimulusSolidDamping, float64(m.SolidTexelsBetween(s.Source, pos)))
+	if intensity < threshold {
+		return 0
+	}
+	return intensity
+}
+
+// StimulusEmitter is an optional interface for entities that make stimuli. The world collects them after every
+// entity has finished its logic, so they are heard on the next step.
+type StimulusEmitter interface {
+	// TakeStimuli appends the stimuli made since it was last called to dst, and forgets them
+	TakeStimuli(dst []Stimulus) []Stimulus
+}
+
+// stimulusBuffer holds the stimuli an entity makes during its logic, until the world collects them.
+// It can be embedded in an entity to implement StimulusEmitter.
+type stimulusBuffer struct {
+	emitted []Stimulus
+}
+
+func (b *stimulusBuffer) emit(s Stimulus) {
+	b.emitted = append(b.emitted, s)
+}
+
+func (b *stimulusBuffer) TakeStimuli(dst []Stimulus) []Stimulus {
+	dst = append(dst, b.emitted...)
+	b.emitted = b.emitted[:0]
+	return dst
+}
+
+// HeardStimulus is a stimulus as heard by an entity
+type HeardStimulus struct {
+	Kind      string
+	Dir       pixel.Vec // Unit vector towards the source
+	Distance  float64
+	Intensity float64
+}
+
+// Loudest returns the loudest stimulus heard of any of the kinds, if any were heard
+func (p *Perception) Loudest(kinds []string) (HeardStimulus, bool) {
+	var loudest HeardStimulus
+	found := false
+	for _, h := range p.Heard {
+		if h.Intensity > loudest.Intensity && slices.Contains(kinds, h.Kind) {
+			loudest, found = h, true
+		}
+	}
+	return loudest, found
+}
+
+// hear fills the perception with every stimulus in the world loud enough to hear at the entity's position
+func (s *Senses) hear(self Entity, w *World, p *Perception) {
+	p.Heard = p.Heard[:0]
+	if s.Hearing <= 0 {
+		return
+	}
+	pos := self.Position()
+	for _, st := range w.Stimuli() {
+		if st.Emitter == self {
+			continue
+		}
+		if intensity := st.IntensityAt(w.Map, pos, s.Hearing); intensity > 0 {
+			offset := st.Source.Sub(pos)
+			p.Heard = append(p.Heard, HeardStimulus{st.Kind, offset.Unit(), offset.Len(), intensity})
+		}
+	}
+}
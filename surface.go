@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"math"
+
+	"github.com/gopxl/pixel"
+)
+
+// SurfaceParams place the sea surface on the map, and shape the waves that run along it
+type SurfaceParams struct {
+	Level      float64 `json:"level"`       // Height of the calm sea surface above the bottom of the map
+	WaveHeight float64 `json:"wave-height"` // Height of the wave crests above the calm surface
+	WaveLength float64 `json:"wave-length"` // Distance between wave crests
+	WaveSpeed  float64 `json:"wave-speed"`  // Speed the waves travel along the surface
+}
+
+// validate checks that the surface can be found with the parameters, as depths and wave phases are divided by them
+func (s *SurfaceParams) validate() error {
+	if s.Level <= 0 || s.WaveLength <= 0 {
+		return errors.New("surface level and wave-length must be positive")
+	}
+	return nil
+}
+
+// AirSettings control what happens to entities above the sea surface
+type AirSettings struct {
+	Gravity         float64 `json:"gravity"`          // Downward acceleration in the air. Entities in the water are held up by it.
+	SplashSpeed     float64 `json:"splash-speed"`     // Slowest vertical speed crossing the surface that makes a splash
+	SplashDamping   float64 `json:"splash-damping"`   // Fraction of the vertical speed lost when falling into the water
+	SplashIntensity float64 `json:"splash-intensity"` // How loud a splash is for each unit of momentum crossing the surface
+}
+
+// SurfaceAt returns the height of the sea surface at a position along the map, at a time in seconds.
+// Two waves travelling at different speeds are added together, so the surface does not look too regular.
+func (s SurfaceParams) SurfaceAt(x, t float64) float64 {
+	k := 2 * math.Pi / s.WaveLength
+	phase := k * (x - s.WaveSpeed*t)
+	return s.Level + s.WaveHeight*(0.7*math.Sin(phase)+0.3*math.Sin(2.3*phase+1.7*k*s.WaveSpeed*t))
+}
+
+// SurfaceAt returns the height of the sea surface at a position along the map on this step
+func (w *World) SurfaceAt(x float64) float64 {
+	return w.Map.Surface.SurfaceAt(x, w.Time())
+}
+
+// InWater returns whether a point is below the sea surface on this step. Entities can only swim in the water.
+func (w *World) InWater(pos pixel.Vec) bool {
+	return pos.Y < w.SurfaceAt(pos.X)
+}
+
+// applyGravity pulls an entity down if it is above the sea surface
+func (w *World) applyGravity(e Entity) {
+	if !w.InWater(e.Position()) {
+		e.ApplyForce(pixel.V(0, -w.Air.Gravity*e.Mass()))
+	}
+}
+
+// crossedSurface returns whether an entity moving from one position to its current one crossed the sea surface
+// fast enough to splash
+func (w *World) crossedSurface(e Entity, from pixel.Vec) bool {
+	return w.InWater(from) != w.InWater(e.Position()) && math.Abs(e.Velocity().Y) > w.Air.SplashSpeed
+}
+
+// splash makes a splash where an entity crossed the surface, as loud as its momentum, to be heard on the next step.
+// Entities falling into the water are slowed by an impulse against their fall, applied on the next step.
+func (w *World) splash(e Entity) {
+	x, vy := e.Position().X, e.Velocity().Y
+	intensity := w.Air.SplashIntensity * e.Mass() * math.Abs(vy)
+	w.stimuli = append(w.stimuli, Stimulus{StimulusSplash, pixel.V(x, w.SurfaceAt(x)), intensity, e})
+	if vy < 0 {
+		e.ApplyImpulse(pixel.V(0, -vy*e.Mass()*w.Air.SplashDamping))
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gopxl/pixel"
+	"github.com/gopxl/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// TimeScales are the speeds the simulation can run at, in ticks per frame
+var TimeScales = []float64{0.25, 1, 4, 16}
+
+// TimeControl decides how many fixed steps the world takes each frame, so it can be paused,
+// advanced one tick at a time, or sped up and slowed down. The world clock only moves when it steps,
+// so entity logic timed with World.Time keeps behaving the same at any speed.
+type TimeControl struct {
+	Paused    bool
+	scale     int // Index into TimeScales
+	pending   float64
+	stepOnce  bool
+	indicator *text.Text
+}
+
+// NewTimeControl creates a running time control at one tick per frame
+func NewTimeControl() *TimeControl {
+	return &TimeControl{
+		scale:     1,
+		indicator: text.New(pixel.ZV, globalTextAtlas),
+	}
+}
+
+// HandleInput reads the time control actions. Stepping advances a single tick, pausing first if needed.
+func (t *TimeControl) HandleInput(input *InputMap) {
+	if input.JustPressed(ActionPause) {
+		t.Paused = !t.Paused
+	}
+	if input.Repeated(ActionStep) {
+		t.Paused = true
+		t.stepOnce = true
+	}
+	if input.JustPressed(ActionSlower) && t.scale > 0 {
+		t.scale--
+	}
+	if input.JustPressed(ActionFaster) && t.scale < len(TimeScales)-1 {
+		t.scale++
+	}
+}
+
+// Scale returns the current number of ticks per frame when running
+func (t *TimeControl) Scale() float64 {
+	return TimeScales[t.scale]
+}
+
+// TicksThisFrame returns how many times the world should step this frame.
+// Slower speeds carry fractions of a tick over to later frames.
+func (t *TimeControl) TicksThisFrame() int {
+	if t.Paused {
+		t.pending = 0
+		if t.stepOnce {
+			t.stepOnce = false
+			return 1
+		}
+		return 0
+	}
+	t.pending += t.Scale()
+	ticks := int(t.pending)
+	t.pending -= float64(ticks)
+	return ticks
+}
+
+// String describes the current speed
+func (t *TimeControl) String() string {
+	if t.Paused {
+		return "paused"
+	}
+	return fmt.Sprintf("%gx", t.Scale())
+}
+
+// Render shows the current speed in the top right of the rect, unless running at normal speed
+func (t *TimeControl) Render(target pixel.Target, rect pixel.Rect) {
+	if !t.Paused && t.Scale() == 1 {
+		return
+	}
+	t.indicator.Clear()
+	t.indicator.Color = colornames.Yellow
+	t.indicator.WriteString(t.String())
+	pos := pixel.V(rect.Max.X-t.indicator.Bounds().W()-5, rect.Max.Y-globalTextAtlas.LineHeight()-5)
+	t.indicator.Draw(target, pixel.IM.Moved(pos))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path"
+	"time"
+)
+
+// FileWatcher polls files and directories for changes, and reports the path of any file that has been modified.
+// Directories are not recursive, but files added to them will be reported.
+type FileWatcher struct {
+	paths    []string
+	modTimes map[string]time.Time
+	changes  chan string
+	stop     chan struct{}
+}
+
+// NewFileWatcher starts watching the given paths, checking them once every interval
+func NewFileWatcher(interval time.Duration, paths ...string) *FileWatcher {
+	w := &FileWatcher{
+		paths:    paths,
+		modTimes: make(map[string]time.Time),
+		changes:  make(chan string, 64),
+		stop:     make(chan struct{}),
+	}
+	// The first scan only records the current state of the files
+	w.scan(false)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.scan(true)
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// Changes is a channel which will receive the path of every file that changes
+func (w *FileWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Close stops the watcher from polling
+func (w *FileWatcher) Close() {
+	close(w.stop)
+}
+
+func (w *FileWatcher) scan(report bool) {
+	for _, p := range w.paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			w.check(p, info, report)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			if info, err := e.Info(); err == nil {
+				w.check(path.Join(p, e.Name()), info, report)
+			}
+		}
+	}
+}
+
+func (w *FileWatcher) check(p string, info os.FileInfo, report bool) {
+	last, seen := w.modTimes[p]
+	if seen && !info.ModTime().After(last) {
+		return
+	}
+	w.modTimes[p] = info.ModTime()
+	if report {
+		select {
+		case w.changes <- p:
+		default:
+			// Nobody is reading changes fast enough, this change will be picked up on a later scan
+			delete(w.modTimes, p)
+		}
+	}
+}
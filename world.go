@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+	"time"
+
+	"github.com/gopxl/pixel"
+)
+
+// World holds the map and entities being simulated, and steps them forward one fixed timestep at a time.
+//
+// Each step runs in phases, and each phase is split across workers:
+//   - Logic: StepLogic is called on every entity concurrently. It may read the state of any entity,
+//     but may only write to its own (for example by applying forces to itself). Stimuli made by entities
+//     are then collected in order, to be heard during the next step.
+//   - Scent: scent deposited by entities is added to the scent field in order, then it spreads and fades.
+//   - Fluid: if the water is simulated, entities push on it in order, then it flows. This only happens every few ticks.
+//   - Physics: StepPhysics is called on every non-kinematic entity concurrently, after gravity pulls down any that
+//     are above the sea surface. Entities that crossed the surface then splash in order.
+//   - Constraints: every constraint is solved in order, repeatedly, on a single goroutine. Damped constraints are then
+//     damped once.
+//   - Collisions: contacts are solved in batches that share no entities, then entities are pushed out of the map.
+//
+// The result of a step does not depend on the number of workers.
+type World struct {
+	Map                  *Map
+	Entities             *EntitiesContainer
+	Constraints          []Constraint
+	ConstraintIterations int
+	CurrentStrength      float64
+	Air                  AirSettings
+	Collision            CollisionSettings
+	Scent                *ScentField
+	Fluid                *FluidField // Nil unless the movement of the water is simulated
+	Tick                 int
+
+	workers        int
+	grid           *SpatialGrid
+	pairs          [][2]int
+	pairBatches    [][][2]int
+	lastCollisions int
+	lastTimings    StepTimings
+	stimuli        []Stimulus
+	nextStimuli    []Stimulus
+	deposits       []ScentDeposit
+	crossed        []bool
+}
+
+// StepTimings is how long each phase of a step took
+type StepTimings struct {
+	Logic       time.Duration
+	Scent       time.Duration
+	Fluid       time.Duration
+	Physics     time.Duration
+	Constraints time.Duration
+	Collisions  time.Duration
+}
+
+// NewWorld creates a world around a map with no entities. workers is the number of goroutines to use, 0 for one per CPU.
+// The scent field uses the default settings until it is given others.
+func NewWorld(m *Map, workers int) *World {
+	return &World{
+		Map:                  m,
+		Entities:             NewEntitiesContainer(),
+		ConstraintIterations: 8,
+		Air:                  DefSimSettings.Air,
+		Collision:            DefSimSettings.Collision,
+		Scent:                NewScentField(m, &DefSimSettings.Scent),
+		workers:              NumWorkers(workers),
+		grid:                 NewSpatialGrid(1),
+	}
+}
+
+// NewWorldWithSettings creates an empty world on a map, set up with the physics, scent and fluid settings.
+// The scent and fluid settings are shared, so changing them affects the world while it is running.
+func NewWorldWithSettings(m *Map, settings *SimulationSettings, workers int) *World {
+	world := NewWorld(m, workers)
+	world.ConstraintIterations = settings.ConstraintIterations
+	world.CurrentStrength = settings.CurrentStrength
+	world.Air = settings.Air
+	world.Collision = settings.Collision
+	world.Scent.Settings = &settings.Scent
+	if settings.Fluid.Enabled {
+		world.Fluid = NewFluidField(m, &settings.Fluid)
+	}
+	return world
+}
+
+// CurrentAt returns the velocity of the water at a position. The current slowly sways back and forth,
+// out of phase across the map, on top of any flow of the simulated water.
+func (w *World) CurrentAt(pos pixel.Vec) pixel.Vec {
+	t := float64(w.Tick) * FixedPhysicsTimestep
+	return pixel.V(math.Sin(t*0.5+pos.X*0.05)*w.CurrentStrength, 0).Add(w.FlowAt(pos))
+}
+
+// FlowAt returns the velocity of the simulated water at a position, which is still if it is not being simulated.
+// Swimmers should drag against it, so they are carried along by the water they have stirred up.
+func (w *World) FlowAt(pos pixel.Vec) pixel.Vec {
+	if w.Fluid == nil {
+		return pixel.ZV
+	}
+	return w.Fluid.VelocityAt(pos)
+}
+
+// AddConstraint adds constraints to be solved every step
+func (w *World) AddConstraint(cs ...Constraint) {
+	w.Constraints = append(w.Constraints, cs...)
+}
+
+// Grid returns the broad phase grid, as it was built during the last step
+func (w *World) Grid() *SpatialGrid {
+	return w.grid
+}
+
+// LastCollisions returns the number of entity pairs that were touching during the last step
+func (w *World) LastCollisions() int {
+	return w.lastCollisions
+}
+
+// LastTimings returns how long each phase of the last step took
+func (w *World) LastTimings() StepTimings {
+	return w.lastTimings
+}
+
+// Stimuli returns the stimuli that can be heard during this step
+func (w *World) Stimuli() []Stimulus {
+	return w.stimuli
+}
+
+// Emit makes a stimulus from outside the world, such as from the user. It must not be called while the world is stepping.
+// It is heard during the next step.
+func (w *World) Emit(s Stimulus) {
+	w.stimuli = append(w.stimuli, s)
+}
+
+// Time returns the simulated time in seconds since the world was created
+func (w *World) Time() float64 {
+	return float64(w.Tick) * FixedPhysicsTimestep
+}
+
+// Step advances the world by one fixed timestep
+func (w *World) Step() {
+	all := w.Entities.All()
+	// Logic can use the broad phase, so build it from the state at the start of the step
+	w.grid.Build(all)
+	phaseStart := time.Now()
+	endPhase := func(d *time.Duration) {
+		*d = time.Since(phaseStart)
+		phaseStart = time.Now()
+	}
+
+	// Update logic for entities
+	ParallelFor(len(all), w.workers, func(start, end int) {
+		for _, e := range all[start:end] {
+			e.StepLogic(w)
+		}
+	})
+	// Replace the stimuli heard this step with the ones made during it, and collect the scent deposited,
+	// in entity order so it does not depend on the workers
+	w.nextStimuli, w.deposits = w.nextStimuli[:0], w.deposits[:0]
+	for _, e := range all {
+		if emitter, ok := e.(StimulusEmitter); ok {
+			w.nextStimuli = emitter.TakeStimuli(w.nextStimuli)
+		}
+		if depositor, ok := e.(ScentDepositor); ok {
+			w.deposits = depositor.TakeDeposits(w.deposits)
+		}
+	}
+	w.stimuli, w.nextStimuli = w.nextStimuli, w.stimuli
+	endPhase(&w.lastTimings.Logic)
+
+	// Spread the scent, now nothing is smelling it
+	w.Scent.Step(w.deposits, w.workers)
+	endPhase(&w.lastTimings.Scent)
+
+	// Let the entities push the water, and the water flow, before they move on
+	if w.Fluid != nil {
+		w.Fluid.Step(w, all)
+	}
+	endPhase(&w.lastTimings.Fluid)
+
+	// Update forces and integrate kinematics
+	w.crossed = slices.Grow(w.crossed[:0], len(all))[:len(all)]
+	ParallelFor(len(all), w.workers, func(start, end int) {
+		for i := start; i < end; i++ {
+			e := all[i]
+			w.crossed[i] = false
+			if !e.IsKinematic() {
+				from := e.Position()
+				w.applyGravity(e)
+				e.StepPhysics()
+				w.crossed[i] = w.crossedSurface(e, from)
+			}
+		}
+	})
+	// Splash in entity order, so the stimuli do not depend on the workers
+	for i, e := range all {
+		if w.crossed[i] {
+			w.splash(e)
+		}
+	}
+	endPhase(&w.lastTimings.Physics)
+
+	// Iteratively pull entities back into place, more iterations makes constraints stiffer
+	for i := 0; i < w.ConstraintIterations; i++ {
+		for _, c := range w.Constraints {
+			c.Solve()
+		}
+	}
+	for _, c := range w.Constraints {
+		if d, ok := c.(DampedConstraint); ok {
+			d.Damp()
+		}
+	}
+	endPhase(&w.lastTimings.Constraints)
+
+	// Process collisions and ensure the solver ends in a valid state
+	w.solveCollisions(all)
+	endPhase(&w.lastTimings.Collisions)
+	w.Tick++
+}
+
+// solveCollisions collides every pair of touching entities, then every entity with the map.
+//
+// Contact pairs are found with the broad phase and greedily coloured, in a fixed order, so that no two pairs
+// with the same colour share an entity. Each colour is then solved in parallel, one colour after another.
+// Since the colouring only depends on the entities, the result is the same no matter how many workers there are.
+func (w *World) solveCollisions(all []Entity) {
+	w.grid.Build(all)
+	w.pairs = w.pairs[:0]
+	for i, e := range all {
+		w.grid.CandidatesAfter(i, func(j int) {
+			// Include pairs that are nearly touching, as they may be pushed together by other contacts
+			margin := (e.Radius() + all[j].Radius()) * 1.1
+			if e.Position().Sub(all[j].Position()).Len() < margin {
+				w.pairs = append(w.pairs, [2]int{i, j})
+			}
+		})
+	}
+
+	// Colour the pairs. Each entity remembers which of the first 64 colours it is already in, as the bits of a uint64,
+	// and any pair that can't fit in one of those goes in a final batch which is solved serially.
+	usedColours := make([]uint64, len(all))
+	for i := range w.pairBatches {
+		w.pairBatches[i] = w.pairBatches[i][:0]
+	}
+	var overflow [][2]int
+	for _, p := range w.pairs {
+		free := ^(usedColours[p[0]] | usedColours[p[1]])
+		if free == 0 {
+			overflow = append(overflow, p)
+			continue
+		}
+		colour := bits.TrailingZeros64(free)
+		usedColours[p[0]] |= 1 << colour
+		usedColours[p[1]] |= 1 << colour
+		for len(w.pairBatches) <= colour {
+			w.pairBatches = append(w.pairBatches, nil)
+		}
+		w.pairBatches[colour] = append(w.pairBatches[colour], p)
+	}
+
+	// Solve each colour in parallel, with each pair recording whether it touched so there is no shared counter
+	collisions := 0
+	solve := func(batch [][2]int, workers int) {
+		counts := make([]int, len(batch))
+		ParallelFor(len(batch), workers, func(start, end int) {
+			for k := start; k < end; k++ {
+				if CollideEntityEntity(all[batch[k][0]], all[batch[k][1]]) {
+					counts[k] = 1
+				}
+			}
+		})
+		for _, c := range counts {
+			collisions += c
+		}
+	}
+	for _, batch := range w.pairBatches {
+		solve(batch, w.workers)
+	}
+	solve(overflow, 1)
+	w.lastCollisions = collisions
+
+	// Each entity collides with the map on its own, so this can be done all at once
+	ParallelFor(len(all), w.workers, func(start, end int) {
+		for _, e := range all[start:end] {
+			CollideMapEntity(w.Map, e, w.Collision.SweepSpeed)
+		}
+	})
+}
+
+// WorldSnapshot is a copy of the entities, constraints, stimuli, scent and water of a world at one tick.
+// The map is not copied, as it does not change while the world is running.
+type WorldSnapshot struct {
+	Tick        int
+	entities    []Entity
+	constraints []Constraint
+	stimuli     []Stimulus
+	scent       *ScentField
+	fluid       *FluidField
+}
+
+// Snapshot copies the current state of the world
+func (w *World) Snapshot() *WorldSnapshot {
+	entities, constraints, remap := cloneEntities(w.Entities.All(), w.Constraints)
+	snapshot := &WorldSnapshot{w.Tick, entities, constraints, remapStimuli(w.stimuli, remap), w.Scent.Clone(), nil}
+	if w.Fluid != nil {
+		snapshot.fluid = w.Fluid.Clone()
+	}
+	return snapshot
+}
+
+// Restore sets the world back to the state in a snapshot. The snapshot can be restored again later.
+func (w *World) Restore(s *WorldSnapshot) {
+	entities, constraints, remap := cloneEntities(s.entities, s.constraints)
+	w.Tick = s.Tick
+	w.Entities = NewEntitiesContainer()
+	for _, e := range entities {
+		w.Entities.Add(e)
+	}
+	w.Constraints = constraints
+	w.stimuli = remapStimuli(s.stimuli, remap)
+	w.Scent = s.scent.Clone()
+	w.Fluid = nil
+	if s.fluid != nil {
+		w.Fluid = s.fluid.Clone()
+	}
+}
+
+// remapStimuli copies stimuli, swapping their emitters for the clones of the entities that made them
+func remapStimuli(stimuli []Stimulus, remap func(Entity) Entity) []Stimulus {
+	clones := make([]Stimulus, len(stimuli))
+	for i, s := range stimuli {
+		clones[i] = s
+		if s.Emitter != nil {
+			clones[i].Emitter = remap(s.Emitter)
+		}
+	}
+	return clones
+}
+
+// cloneEntities deep copies entities and the constraints between them, so the copies only refer to each other.
+// It also returns the function that finds the clone of an original entity.
+func cloneEntities(entities []Entity, constraints []Constraint) ([]Entity, []Constraint, func(Entity) Entity) {
+	clones := make([]Entity, len(entities))
+	cloneOf := make(map[Entity]Entity, len(entities))
+	for i, e := range entities {
+		clones[i] = e.Clone()
+		cloneOf[e] = clones[i]
+	}
+	remap := func(e Entity) Entity { return cloneOf[e] }
+	for _, c := range clones {
+		if r, ok := c.(EntityReferencer); ok {
+			r.RemapEntities(remap)
+		}
+	}
+	clonedConstraints := make([]Constraint, len(constraints))
+	for i, c := range constraints {
+		clonedConstraints[i] = c.Remap(remap)
+	}
+	return clones, clonedConstraints, remap
+}
+
+// Checksum hashes the tick, the position and velocity of every entity, the scent field and the flow of the water.
+// Two worlds that have run identically will have the same checksum.
+func (w *World) Checksum() uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	write := func(v float64) {
+		binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+		h.Write(buf)
+	}
+	write(float64(w.Tick))
+	for _, e := range w.Entities.All() {
+		write(e.Position().X)
+		write(e.Position().Y)
+		write(e.Velocity().X)
+		write(e.Velocity().Y)
+	}
+	for _, values := range w.Scent.values {
+		for _, v := range values {
+			write(v)
+		}
+	}
+	if w.Fluid != nil {
+		for i := range w.Fluid.vx {
+			write(w.Fluid.vx[i])
+			write(w.Fluid.vy[i])
+		}
+	}
+	return h.Sum64()
+}
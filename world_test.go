@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gopxl/pixel"
+)
+
+// buildTestWorld builds the school scenario with a few of every other kind of entity mixed in, stepped by workers
+func buildTestWorld(t testing.TB, workers int) (*World, *SimulationSettings) {
+	t.Helper()
+	settings, _, err := LoadSettings(DefSettingsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := LoadScenario("data/scenarios/school.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err = scenario.ApplySettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	world, err := scenario.BuildWorld(&settings, workers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := NewRNG(7)
+	for i, kind := range []string{"predator", "food", "sardine", "shark", "tuna", "sardine", "predator", "food"} {
+		pos, ok := randomWaterPosition(world.Map, &rng, pixel.V(2, 150), pixel.V(510, 230))
+		if !ok {
+			t.Fatalf("no water to spawn %s in", kind)
+		}
+		e, err := SpawnEntity(kind, pos, &settings, int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		world.Entities.Add(e)
+	}
+	return world, &settings
+}
+
+// TestParallelStepMatchesSerial steps the same world with one worker and with several. Run it with -race to check
+// that the phases really only write to what they own.
+func TestParallelStepMatchesSerial(t *testing.T) {
+	ticks := 120
+	if testing.Short() {
+		ticks = 30
+	}
+	var checksums []uint64
+	for _, workers := range []int{1, 4} {
+		world, settings := buildTestWorld(t, workers)
+		for world.Tick < ticks {
+			if world.Tick == ticks/2 {
+				// Scatter everything, so the collision solver has plenty of contacts to colour
+				if err := ApplyReplayEvent(world, settings, ReplayEvent{Type: ReplayScatter, Seed: 3}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			world.Step()
+		}
+		checksums = append(checksums, world.Checksum())
+	}
+	if checksums[0] != checksums[1] {
+		t.Errorf("checksum with 4 workers %x does not match 1 worker %x", checksums[1], checksums[0])
+	}
+}